@@ -0,0 +1,82 @@
+// Copyleft 2020
+
+package accountapi2
+
+import (
+	"context"
+
+	v1 "github.com/DenesPal/interview-accountapi"
+)
+
+// Creates an Account resource and returns the latest version of it (see v1.ApiClient.CreateAccount)
+func (client *ApiClient) CreateAccount(ctx context.Context, account *Account) (*Account, error) {
+	account, apiErr := client.client.CreateAccount(ctx, account)
+	return account, toError(apiErr)
+}
+
+// Fetches an Account resource by id, the error matches ErrNotFound if it's missing (see v1.ApiClient.FetchAccount)
+func (client *ApiClient) FetchAccount(ctx context.Context, id string) (*Account, error) {
+	account, apiErr := client.client.FetchAccount(ctx, id)
+	return account, toError(apiErr)
+}
+
+// Updates an Account resource, returns the resource as received in the response
+func (client *ApiClient) UpdateAccount(ctx context.Context, id string, account *Account) (*Account, error) {
+	account, apiErr := client.client.UpdateAccount(ctx, id, account)
+	return account, toError(apiErr)
+}
+
+// Deletes an Account resource by id, returns error or nil on success
+func (client *ApiClient) DeleteAccount(ctx context.Context, id string, version uint) error {
+	return toError(client.client.DeleteAccount(ctx, id, version))
+}
+
+// Iterator over the results of ListAccounts, not safe for concurrent use.
+//
+// A possible use pattern:
+//
+//	accounts := client.ListAccounts(ctx, nil)
+//	defer accounts.Close()
+//	for accounts.Next() {
+//		account := accounts.Account()
+//	}
+//	if err := accounts.Err(); err != nil {
+//	}
+type AccountIterator struct {
+	results *v1.AccountListResults
+	account *Account
+	err     error
+}
+
+// List Account resources with optional filters (or nil), iterating through the pages as the results are consumed
+// (see v1.ApiClient.ListAccounts). The iterator shall be closed when not exhausted.
+func (client *ApiClient) ListAccounts(ctx context.Context, filters map[string]string) *AccountIterator {
+	return &AccountIterator{results: client.client.ListAccounts(ctx, filters)}
+}
+
+// Next advances to the next Account, returns false when the results are exhausted or on error (see Err)
+func (accounts *AccountIterator) Next() bool {
+	account, ok := <-accounts.results.Channel
+	if !ok {
+		accounts.account = nil
+		accounts.err = toError(accounts.results.Error)
+		return false
+	}
+	accounts.account = account
+	return true
+}
+
+// Account returns the current Account, the one Next advanced to
+func (accounts *AccountIterator) Account() *Account {
+	return accounts.account
+}
+
+// Err returns the error that stopped the iteration, nil if the results were exhausted (or before Next returned false)
+func (accounts *AccountIterator) Err() error {
+	return accounts.err
+}
+
+// Close terminates the listing, never blocks and may be invoked multiple times
+func (accounts *AccountIterator) Close() {
+	accounts.results.Close()
+}
@@ -0,0 +1,119 @@
+// Copyleft 2020
+
+package accountapi2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	v1 "github.com/DenesPal/interview-accountapi"
+)
+
+func newTestServer(t *testing.T, handler http.HandlerFunc) *ApiClient {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client, err := NewApiClient(v1.WithBaseURL(server.URL + "/"))
+	if err != nil {
+		t.Fatalf("Failed to create ApiClient: %s", err)
+	}
+	client.V1().SetRetries(1)
+	return client
+}
+
+func TestFetchAccount(t *testing.T) {
+	client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", v1.ContentType)
+		if r.URL.Path != "/"+v1.AccountsPath+"/1" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error_message":"not found"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":{"id":"1"}}`))
+	})
+
+	account, err := client.FetchAccount(context.Background(), "1")
+	// Nil as error interface, not a typed nil pointer
+	if err != nil || account == nil || account.Id != "1" {
+		t.Fatalf("FetchAccount() = %v, %#v", account, err)
+	}
+
+	_, err = client.FetchAccount(context.Background(), "2")
+	var apiErr *ApiError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || !errors.Is(err, ErrNotFound) {
+		t.Errorf("Unexpected error: %#v", err)
+	}
+	if AsApiError(err) != apiErr || AsApiError(context.Canceled) != nil {
+		t.Error("AsApiError() returned unexpected ApiError")
+	}
+}
+
+func TestDeleteAccount(t *testing.T) {
+	client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete || r.URL.Query().Get("version") != "0" {
+			t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	var err error = client.DeleteAccount(context.Background(), "1", 0)
+	if err != nil {
+		t.Errorf("DeleteAccount() failed: %#v", err)
+	}
+	if err := client.DeleteAccount(context.Background(), "", 0); !errors.Is(err, ErrValidation) {
+		t.Errorf("Unexpected error: %#v", err)
+	}
+}
+
+func TestListAccounts(t *testing.T) {
+	var pages int
+	client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", v1.ContentType)
+		pages++
+		if pages > 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"data":[{"id":"%d"}],"links":{"next":"/%s?page[number]=%d"}}`,
+			pages, v1.AccountsPath, pages)
+	})
+	client.V1().SetPaginationBackOff(0)
+
+	accounts := client.ListAccounts(context.Background(), nil)
+	defer accounts.Close()
+	var ids []string
+	for accounts.Next() {
+		ids = append(ids, accounts.Account().Id)
+	}
+	if len(ids) != 2 || ids[0] != "1" || ids[1] != "2" {
+		t.Errorf("Unexpected accounts: %v", ids)
+	}
+	if err := accounts.Err(); !errors.Is(err, ErrValidation) || accounts.Account() != nil {
+		t.Errorf("Unexpected error: %#v", err)
+	}
+
+	accounts = client.ListAccounts(context.Background(), map[string]string{"colour": "red"})
+	if accounts.Next() || !errors.Is(accounts.Err(), ErrValidation) {
+		t.Errorf("Unexpected error of invalid filter: %#v", accounts.Err())
+	}
+}
+
+func TestFromV1(t *testing.T) {
+	legacy, err := v1.NewApiClient()
+	if err != nil {
+		t.Fatalf("Failed to create ApiClient: %s", err)
+	}
+	client := FromV1(legacy)
+	if client.V1() != legacy {
+		t.Error("V1() did not return the wrapped client")
+	}
+	// Configuration is shared
+	legacy.SetRetries(5)
+	if client.V1().Retries() != 5 {
+		t.Error("Configuration of the wrapped client is not shared")
+	}
+}
@@ -0,0 +1,82 @@
+// Copyleft 2020
+
+// Package accountapi2 is the second version of the Form3 toy-API client, with the operations returning the standard
+// error interface. It's a package of the original module rather than a major version of it, so both can be used side by
+// side while the callers are migrated.
+//
+// It's a thin layer over the original client: the transport, retries, caching and the rest of the configuration are
+// the same, the configuration is done on the underlying client (see V1). Errors of the API are *ApiError, reachable
+// with errors.As, and classified by errors.Is against the sentinels like ErrNotFound.
+package accountapi2
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	v1 "github.com/DenesPal/interview-accountapi"
+)
+
+// Type aliases of the original package, so that values pass between the versions without conversion
+type (
+	Account  = v1.Account
+	ApiError = v1.ApiError
+	Option   = v1.Option
+)
+
+// The Form3 API client, safe for concurrent use
+type ApiClient struct {
+	client *v1.ApiClient
+}
+
+// NewApiClient creates a new Form3 API client with defaults, configured by opts (like v1.WithBaseURL).
+// Returns an error if any of the options is invalid.
+func NewApiClient(opts ...Option) (*ApiClient, error) {
+	client, err := v1.NewApiClient(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return FromV1(client), nil
+}
+
+// FromV1 wraps an existing client of the original package, so that callers can be migrated one by one. Both share
+// the configuration and the state (like the cache and the circuit breaker) of client.
+func FromV1(client *v1.ApiClient) *ApiClient {
+	return &ApiClient{client: client}
+}
+
+// V1 returns the underlying client of the original package, for its configuration (like SetRetries) and for the
+// callers not migrated yet
+func (client *ApiClient) V1() *v1.ApiClient {
+	return client.client
+}
+
+// toError converts apiErr to error, keeping nil as a nil interface rather than a typed nil pointer
+func toError(apiErr *ApiError) error {
+	if apiErr == nil {
+		return nil
+	}
+	return apiErr
+}
+
+// NewRequest creates a new HTTP request bound to ctx of method with path relative to the baseURL of the client,
+// and an optional body of io.Reader or nil
+func (client *ApiClient) NewRequest(ctx context.Context, method string, path string, body io.Reader) (
+	*http.Request, error) {
+	return client.client.NewRequest(ctx, method, path, body)
+}
+
+// Do executes req with the retries and the rest of the client's configuration, like v1.ApiClient.Do
+func (client *ApiClient) Do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	resp, apiErr := client.client.Do(ctx, req)
+	return resp, toError(apiErr)
+}
+
+// JsonRequest creates and executes an HTTP request bound to ctx of method with relative path to the baseURL and an
+// optional data (or nil) in the request body (serializes it as JSON). Returns the HTTP response and the JSON decoder.
+func (client *ApiClient) JsonRequest(ctx context.Context, method string, path string, data interface{}) (
+	*http.Response, *json.Decoder, error) {
+	resp, dec, apiErr := client.client.JsonRequest(ctx, method, path, data)
+	return resp, dec, toError(apiErr)
+}
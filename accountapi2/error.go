@@ -0,0 +1,40 @@
+// Copyleft 2020
+
+package accountapi2
+
+import (
+	"errors"
+
+	v1 "github.com/DenesPal/interview-accountapi"
+)
+
+// Sentinels to classify the errors with errors.Is, the same values as in the original package
+var (
+	ErrNotFound        = v1.ErrNotFound
+	ErrConflict        = v1.ErrConflict
+	ErrVersionMismatch = v1.ErrVersionMismatch
+	ErrValidation      = v1.ErrValidation
+	ErrRateLimited     = v1.ErrRateLimited
+	ErrUnavailable     = v1.ErrUnavailable
+	ErrTimeout         = v1.ErrTimeout
+)
+
+// IsRetryable tells whether the operation that failed with err may succeed when retried (see v1.IsRetryable)
+func IsRetryable(err error) bool {
+	return v1.IsRetryable(err)
+}
+
+// IsTemporary tells whether err is expected to go away by itself (see v1.IsTemporary)
+func IsTemporary(err error) bool {
+	return v1.IsTemporary(err)
+}
+
+// AsApiError returns the *ApiError in the chain of err, or nil. Eases migrating the callers reading its properties
+// (like StatusCode).
+func AsApiError(err error) *ApiError {
+	var apiErr *ApiError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	return nil
+}
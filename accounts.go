@@ -3,11 +3,13 @@
 package interview_accountapi
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"path"
+	"strings"
 	"time"
 )
 
@@ -53,26 +55,35 @@ func (results *AccountListResults) finish(apiErr *ApiError) {
 // Parses one page at a time, feeding Account results through AccountListResults.Channel,
 // and fetches next page when the last item of a page is consumed.
 //
-// On error sets AccountListResults.Error (type ApiError) then closes AccountListResults.Channel
+// On error sets AccountListResults.Error (type ApiError) then closes AccountListResults.Channel.
 //
-// AccountListResults.Close shall be invoked to terminate the internal go-routine
+// AccountListResults.Close shall be invoked to terminate the internal go-routine. Cancellation of ctx also terminates
+// it, interrupting the pending page request or the PaginationBackOff delay, with the context error exposed.
 //
 // A possible use pattern is to iterate with range over the AccountListResults.Channel
 // and check for AccountListResults.Error when the results are exhausted (since feeding stops on error).
-func (client *ApiClient) ListAccounts(filters map[string]string) *AccountListResults {
+func (client *ApiClient) ListAccounts(ctx context.Context, filters map[string]string) *AccountListResults {
+	return client.snapshot().listAccounts(ctx, filters)
+}
+
+// listAccounts implements ListAccounts
+func (config *clientConfig) listAccounts(ctx context.Context, filters map[string]string) *AccountListResults {
 	results := &AccountListResults{Channel: make(chan *Account), closing: make(chan bool, 1)}
+	ctx, span := config.tracer.Start(ctx, "ListAccounts")
 
 	// Append filters and pagination to query string
 	u, q, err := parseURL(AccountsPath)
 	if err != nil {
-		results.finish(NewApiError(nil, err.Error()))
+		results.finish(wrapError(nil, err))
+		endSpan(span, results.Error)
 		return results
 	}
-	q.Set("page[size]", fmt.Sprint(client.pageSize))
+	q.Set("page[size]", fmt.Sprint(config.pageSize))
 
 	for k, v := range filters {
 		if !accountListFilters[k] {
-			results.finish(NewApiError(nil, "invalid filter key: %s", k))
+			results.finish(newValidationError(fmt.Errorf("invalid filter key: %s", k)))
+			endSpan(span, results.Error)
 			return results
 		}
 		q.Set(fmt.Sprintf("filter[%s]", k), v)
@@ -89,21 +100,31 @@ func (client *ApiClient) ListAccounts(filters map[string]string) *AccountListRes
 			lastTime time.Time
 		)
 
+	Pages:
 		for i := 0; pth != ""; i++ {
 			// Waits between requesting successive pages
-			sleepDuration := client.PaginationBackOff - time.Now().Sub(lastTime)
+			sleepDuration := config.paginationBackOff - time.Now().Sub(lastTime)
 			if 0 < i && 0 < sleepDuration {
-				log.Printf("Fetching next page of results in %v", sleepDuration)
-				time.Sleep(sleepDuration)
+				config.logger.Log(ctx, LogLevelDebug, "Fetching next page of results",
+					"page", i+1, "delay", sleepDuration)
+				if err := sleepContext(ctx, sleepDuration); err != nil {
+					apiErr = wrapError(nil, err)
+					break Pages
+				}
 			}
 			lastTime = time.Now()
 
 			// Does the actual HTTP request and returns a JSON decoder
-			resp, dec, apiErr = client.JsonRequest(http.MethodGet, pth, nil)
+			pageCtx, pageSpan := config.tracer.Start(ctx, "ListAccounts page")
+			pageSpan.SetAttribute("page", i+1)
+			resp, dec, apiErr = config.jsonRequest(pageCtx, http.MethodGet, pth, nil, nil)
 			if apiErr != nil {
+				endSpan(pageSpan, apiErr)
 				break
 			}
 
+			config.metrics.ObservePage()
+
 			// JSON-decodes response body
 			var response AccountDetailsListResponse
 			err := dec.Decode(&response)
@@ -111,21 +132,27 @@ func (client *ApiClient) ListAccounts(filters map[string]string) *AccountListRes
 			// Close response body (already read all)
 			if e := resp.Body.Close(); e != nil {
 				// Probably safe to ignore this error, hence it is only logged, but isn't propagated through the chan
-				log.Printf("Closing of response body failed: %s", e)
+				config.logger.Log(ctx, LogLevelWarn, "Closing of response body failed", "error", e)
 			}
 
 			// Stops on JSON decoding error from above
 			if err != nil {
-				apiErr = NewApiError(resp, err.Error())
+				apiErr = newDecodeError(resp, err)
+				endSpan(pageSpan, apiErr)
 				break
 			}
+			pageSpan.SetAttribute("results", len(response.Data))
+			endSpan(pageSpan, nil)
 
 			// Feeds results from current page to channel (one-by-one, blocking)
 			for _, acc := range response.Data {
 				select {
 				case <-results.closing:
 					// Stops on close message
-					break
+					break Pages
+				case <-ctx.Done():
+					apiErr = wrapError(nil, ctx.Err())
+					break Pages
 				case results.Channel <- acc:
 				}
 			}
@@ -134,28 +161,76 @@ func (client *ApiClient) ListAccounts(filters map[string]string) *AccountListRes
 				// Was last page
 				break
 			}
-			// Iterates to next page
+			// Iterates to next page, an absolute link of an endpoint is made relative so the page may fail over
 			pth = response.Links.Next
+			if config.endpoints != nil {
+				pth = config.endpoints.relative(pth)
+			}
 
 		}
 
 		// Exposes error (if any) and signals finish to receivers
 		results.finish(apiErr)
+		endSpan(span, apiErr)
 	}()
 
 	return results
 }
 
-// Creates an Account resource and returns the latest version of it
-func (client *ApiClient) CreateAccount(account *Account) (*Account, *ApiError) {
+// Creates an Account resource and returns the latest version of it.
+//
+// By default the POST request carries an Idempotency-Key header, kept across its retries, and the key can be supplied
+// by the caller with WithIdempotencyKey. See CreateMode for the fallback of APIs without idempotency key support.
+func (client *ApiClient) CreateAccount(ctx context.Context, account *Account) (*Account, *ApiError) {
+	return client.snapshot().createAccount(ctx, account)
+}
+
+// createAccount implements CreateAccount
+func (config *clientConfig) createAccount(ctx context.Context, account *Account) (_ *Account, apiErr *ApiError) {
+	ctx, span := config.tracer.Start(ctx, "CreateAccount")
+	defer func() { endSpan(span, apiErr) }()
+
 	if err := account.Validate(); err != nil {
-		return nil, NewApiError(nil, err.Error())
+		return nil, newValidationError(err)
+	}
+	span.SetAttribute("account.id", account.Id)
+
+	if config.createMode == CreateProbeAndRefetch {
+		return config.createAccountProbing(ctx, account)
+	}
+
+	key, err := idempotencyKeyFor(ctx)
+	if err != nil {
+		apiErr = NewApiError(nil, "Generating idempotency key failed: %s", err)
+		apiErr.Err = err
+		return nil, apiErr
+	}
+	span.SetAttribute("idempotency_key", key)
+
+	resp, dec, apiErr := config.jsonRequest(ctx, http.MethodPost, AccountsPath, AccountCreation{account},
+		http.Header{IdempotencyKeyHeader: {key}})
+
+	if apiErr == nil {
+		if strings.EqualFold(resp.Header.Get(IdempotentReplayedHeader), "true") {
+			config.logger.Log(ctx, LogLevelDebug, "Replayed response of idempotent request", "key", key)
+		}
+		return config.decodeAccountCreation(ctx, resp, dec)
+
+	} else if replayedConflict(resp) {
+		// The Conflict was caused by an earlier attempt carrying the same key, which succeeded
+		config.logger.Log(ctx, LogLevelDebug, "Conflict of replayed idempotent request", "key", key)
+		return config.fetchAccount(ctx, account.Id)
 	}
 
+	return nil, apiErr
+}
+
+// createAccountProbing implements CreateAccount in CreateProbeAndRefetch mode
+func (config *clientConfig) createAccountProbing(ctx context.Context, account *Account) (*Account, *ApiError) {
 	// Retrying a POST request can raise a 409 Conflict, this is a scrappy work-around part 1:
 	// Check for existing resource by id and raise a Conflict error now. Then Conflict errors for the POST request
 	// can be interpreted as a retry scenario where the success of the first try was lost.
-	existing, apiErr := client.FetchAccount(account.Id)
+	existing, apiErr := config.fetchAccount(ctx, account.Id)
 	if apiErr == nil {
 		apiErr = NewApiError(nil, "Account with id %s already exists", existing.Id)
 		apiErr.StatusCode = http.StatusConflict
@@ -164,22 +239,15 @@ func (client *ApiClient) CreateAccount(account *Account) (*Account, *ApiError) {
 		return nil, apiErr
 	}
 
-	resp, dec, apiErr := client.JsonRequest(http.MethodPost, AccountsPath, AccountCreation{account})
+	resp, dec, apiErr := config.jsonRequest(ctx, http.MethodPost, AccountsPath, AccountCreation{account}, nil)
 
 	if apiErr == nil {
-		var response AccountCreationResponse
-		if err := dec.Decode(&response); err != nil {
-			apiErr = NewApiError(resp, err.Error())
-		}
-		if e := resp.Body.Close(); e != nil {
-			log.Print("Closing of response body failed!")
-		}
-		return response.Data, apiErr
+		return config.decodeAccountCreation(ctx, resp, dec)
 
 	} else if resp != nil && resp.StatusCode == http.StatusConflict {
 		// Work-around part 2: In case of Conflict, fetch and return the existing resource.
 		// This would introduce a race condition if the same id was used to create resources across multiple clients.
-		if latest, err := client.FetchAccount(account.Id); err == nil {
+		if latest, err := config.fetchAccount(ctx, account.Id); err == nil {
 			return latest, nil
 		}
 	}
@@ -187,65 +255,153 @@ func (client *ApiClient) CreateAccount(account *Account) (*Account, *ApiError) {
 	return nil, apiErr
 }
 
+// decodeAccountCreation decodes the response of a successful POST request and closes its body
+func (config *clientConfig) decodeAccountCreation(ctx context.Context, resp *http.Response, dec *json.Decoder) (
+	*Account, *ApiError) {
+	var response AccountCreationResponse
+	var apiErr *ApiError
+	if err := dec.Decode(&response); err != nil {
+		apiErr = newDecodeError(resp, err)
+	}
+	if e := resp.Body.Close(); e != nil {
+		config.logger.Log(ctx, LogLevelWarn, "Closing of response body failed", "error", e)
+	}
+	return response.Data, apiErr
+}
+
 // Updates an Account resource, returns the resource as received in the response
-func (client *ApiClient) UpdateAccount(id string, account *Account) (*Account, *ApiError) {
+func (client *ApiClient) UpdateAccount(ctx context.Context, id string, account *Account) (*Account, *ApiError) {
+	return client.snapshot().updateAccount(ctx, id, account)
+}
+
+// updateAccount implements UpdateAccount
+func (config *clientConfig) updateAccount(ctx context.Context, id string, account *Account) (
+	_ *Account, apiErr *ApiError) {
+	ctx, span := config.tracer.Start(ctx, "UpdateAccount")
+	defer func() { endSpan(span, apiErr) }()
+	span.SetAttribute("account.id", id)
+
 	if id == "" {
-		return nil, NewApiError(nil, "Empty account id")
+		return nil, newValidationError(errors.New("Empty account id"))
 	}
 	pth := path.Join(AccountsPath, id)
 
 	if err := account.Validate(); err != nil {
-		return nil, NewApiError(nil, err.Error())
+		return nil, newValidationError(err)
 	}
 
-	resp, dec, apiErr := client.JsonRequest(http.MethodPatch, pth, AccountAmendment{account})
+	resp, dec, apiErr := config.jsonRequest(ctx, http.MethodPatch, pth, AccountAmendment{account}, nil)
 	if apiErr != nil {
 		return nil, apiErr
 	}
 
 	var response AccountDetailsResponse
 	if err := dec.Decode(&response); err != nil {
-		apiErr = NewApiError(resp, err.Error())
+		apiErr = newDecodeError(resp, err)
 	}
 	if e := resp.Body.Close(); e != nil {
-		log.Print("Closing of response body failed!")
+		config.logger.Log(ctx, LogLevelWarn, "Closing of response body failed", "error", e)
+	}
+	if config.cache != nil {
+		// The cached account is outdated either way
+		config.cache.Evict(id)
+		if apiErr == nil {
+			config.cache.store(response.Data, resp)
+		}
 	}
 
 	return response.Data, apiErr
 }
 
 // Fetches an Account resource by id, if missing, returns ApiError with .code as 404.
-func (client *ApiClient) FetchAccount(id string) (*Account, *ApiError) {
+// Read through the AccountCache of the client, if any (see SetAccountCache).
+//
+// Concurrent calls for the same id are collapsed into a single request, its result shared by the callers. Cancelling
+// ctx returns to that caller only, the shared request is cancelled once all of its callers are gone.
+func (client *ApiClient) FetchAccount(ctx context.Context, id string) (*Account, *ApiError) {
+	return client.fetches.fetch(ctx, id, func(ctx context.Context) (*Account, *ApiError) {
+		return client.snapshot().fetchAccount(ctx, id)
+	})
+}
+
+// fetchAccount implements FetchAccount
+func (config *clientConfig) fetchAccount(ctx context.Context, id string) (_ *Account, apiErr *ApiError) {
+	ctx, span := config.tracer.Start(ctx, "FetchAccount")
+	defer func() { endSpan(span, apiErr) }()
+	span.SetAttribute("account.id", id)
+
 	if id == "" {
-		return nil, NewApiError(nil, "Empty account id")
+		return nil, newValidationError(errors.New("Empty account id"))
 	}
 	pth := path.Join(AccountsPath, id)
 
-	resp, dec, apiErr := client.JsonRequest(http.MethodGet, pth, nil)
+	// Conditional request if the cached account is stale
+	var conditional http.Header
+	if config.cache != nil {
+		var account *Account
+		if account, conditional = config.cache.lookup(id); account != nil {
+			span.SetAttribute("cache", "hit")
+			return account, nil
+		}
+	}
+
+	resp, dec, apiErr := config.jsonRequest(ctx, http.MethodGet, pth, nil, conditional)
 	if apiErr != nil {
+		if config.cache != nil && apiErr.StatusCode == http.StatusNotFound {
+			config.cache.Evict(id)
+		}
 		return nil, apiErr
 	}
 
+	if resp.StatusCode == http.StatusNotModified {
+		if e := resp.Body.Close(); e != nil {
+			config.logger.Log(ctx, LogLevelWarn, "Closing of response body failed", "error", e)
+		}
+		if account := config.cache.revalidated(id, resp); account != nil {
+			span.SetAttribute("cache", "revalidated")
+			return account, nil
+		}
+		// Evicted meanwhile, fetching again
+		if resp, dec, apiErr = config.jsonRequest(ctx, http.MethodGet, pth, nil, nil); apiErr != nil {
+			return nil, apiErr
+		}
+	}
+	if config.cache != nil {
+		span.SetAttribute("cache", "miss")
+	}
+
 	var response AccountDetailsResponse
 	if err := dec.Decode(&response); err != nil {
-		apiErr = NewApiError(resp, err.Error())
+		apiErr = newDecodeError(resp, err)
 	}
 	if e := resp.Body.Close(); e != nil {
-		log.Print("Closing of response body failed!")
+		config.logger.Log(ctx, LogLevelWarn, "Closing of response body failed", "error", e)
+	}
+	if apiErr == nil && config.cache != nil {
+		config.cache.store(response.Data, resp)
 	}
 
 	return response.Data, apiErr
 }
 
 // Deletes an Account resource by id, returns error or nil on success
-func (client *ApiClient) DeleteAccount(id string, version uint) *ApiError {
+func (client *ApiClient) DeleteAccount(ctx context.Context, id string, version uint) *ApiError {
+	return client.snapshot().deleteAccount(ctx, id, version)
+}
+
+// deleteAccount implements DeleteAccount
+func (config *clientConfig) deleteAccount(ctx context.Context, id string, version uint) (apiErr *ApiError) {
+	ctx, span := config.tracer.Start(ctx, "DeleteAccount")
+	defer func() { endSpan(span, apiErr) }()
+	span.SetAttribute("account.id", id)
+
 	if id == "" {
-		return NewApiError(nil, "Empty account id")
+		return newValidationError(errors.New("Empty account id"))
 	}
 
 	u, v, err := parseURL(AccountsPath)
 	if err != nil {
-		return NewApiError(nil, err.Error())
+		return wrapError(nil, err)
 	}
 
 	u.Path = path.Join(u.Path, id)
@@ -253,14 +409,26 @@ func (client *ApiClient) DeleteAccount(id string, version uint) *ApiError {
 
 	pth := assembleURL(u, v)
 
-	req, err := client.NewRequest(http.MethodDelete, pth, nil)
+	req, err := config.newRequest(ctx, http.MethodDelete, pth, nil)
+	if err != nil {
+		return wrapError(nil, err)
+	}
 
-	resp, apiErr := client.Do(req)
+	resp, apiErr := config.do(ctx, req)
 	if apiErr != nil {
 		return apiErr
 	}
+	defer func() {
+		// Also ends the budget of the request
+		if e := resp.Body.Close(); e != nil {
+			config.logger.Log(ctx, LogLevelWarn, "Closing of response body failed", "error", e)
+		}
+	}()
 
 	if resp.StatusCode == http.StatusNoContent {
+		if config.cache != nil {
+			config.cache.Evict(id)
+		}
 		return nil
 	}
 	return NewApiError(resp, "Failed to delete account %s received status %s", id, resp.Status)
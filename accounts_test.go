@@ -2,16 +2,72 @@ package interview_accountapi
 
 import (
 	"fmt"
-	"math/rand"
+	"hash/fnv"
 	"net/http"
+	"os"
 	"testing"
-	"time"
 )
 
+const (
+	// Path of a Cassette to record the tests into, or to replay them from
+	cassetteEnvKey = "API_CASSETTE"
+	// Mode of the Cassette, "replay" (default) or "record"
+	cassetteModeEnvKey = "API_CASSETTE_MODE"
+	// Base URL of replaying a Cassette, when API_URL is not set
+	cassetteApiBase = "http://localhost:8080/"
+	// Random seed of the tests with a Cassette (combined with the name of the test), so the random requests match the
+	// recorded ones
+	cassetteSeed = 20201020
+)
+
+// newAccountsTestContext returns a TestContext for the API at API_URL, recording or replaying its exchanges with a
+// Cassette of its own if API_CASSETTE is set. Skips the test if neither is set.
+func newAccountsTestContext(t *testing.T) *TestContext {
+	cassettePath := os.Getenv(cassetteEnvKey)
+	if cassettePath == "" {
+		if os.Getenv(ApiUrlEnvKey) == "" {
+			t.Skipf("Neither %s nor %s is set", ApiUrlEnvKey, cassetteEnvKey)
+		}
+		return NewTestContext(t)
+	}
+
+	mode := CassetteReplay
+	if modeName := os.Getenv(cassetteModeEnvKey); modeName != "" {
+		var err error
+		if mode, err = ParseCassetteMode(modeName); err != nil {
+			t.Fatalf("Invalid environment variable %s: %s", cassetteModeEnvKey, err)
+		}
+	}
+	apiBase := os.Getenv(ApiUrlEnvKey)
+	if apiBase == "" && mode == CassetteReplay {
+		apiBase = cassetteApiBase
+	}
+
+	// The same seed in both modes, so the generated accounts match the recorded ones
+	name := fnv.New64a()
+	_, _ = name.Write([]byte(t.Name()))
+	test := newTestContext(t, apiBase, cassetteSeed^int64(name.Sum64()))
+
+	cassette, err := NewCassette(cassettePath, mode)
+	if err != nil {
+		t.Fatalf("Failed to open cassette: %s", err)
+	}
+	t.Cleanup(func() {
+		if err := cassette.Close(); err != nil {
+			t.Errorf("Failed to close cassette: %s", err)
+		}
+	})
+	test.Client.Use(cassette.Middleware)
+	test.Ctx = WithCassetteScope(test.Ctx, t.Name())
+	t.Logf("Using cassette %s in %s mode", cassettePath, mode)
+
+	return test
+}
+
 func (test *TestContext) ListAccounts(filters map[string]string) (map[string]uint, *ApiError) {
 	test.T.Logf("ListAccounts(%s)", filters)
 
-	results := test.Client.ListAccounts(filters)
+	results := test.Client.ListAccounts(test.Ctx, filters)
 	accountVersionMap := make(map[string]uint)
 	for account := range results.Channel {
 		accountVersionMap[account.Id] = account.Version
@@ -23,12 +79,12 @@ func (test *TestContext) ListAccounts(filters map[string]string) (map[string]uin
 
 func (test *TestContext) FetchAccount(id string) (*Account, *ApiError) {
 	test.T.Logf("FetchAccount(%s)", id)
-	return test.Client.FetchAccount(id)
+	return test.Client.FetchAccount(test.Ctx, id)
 }
 
 func (test *TestContext) DeleteAccount(id string, version uint) *ApiError {
 	test.T.Logf("DeleteAccount(%s, version=%d)", id, version)
-	return test.Client.DeleteAccount(id, version)
+	return test.Client.DeleteAccount(test.Ctx, id, version)
 }
 
 func (test *TestContext) CreateAccount(accountBud *Account) (*Account, *ApiError) {
@@ -38,7 +94,7 @@ func (test *TestContext) CreateAccount(accountBud *Account) (*Account, *ApiError
 		accountBud = test.NewAccountBud()
 	}
 
-	account, apiErr := test.Client.CreateAccount(accountBud)
+	account, apiErr := test.Client.CreateAccount(test.Ctx, accountBud)
 
 	if apiErr == nil {
 		if e := printJson(account); e != nil {
@@ -51,9 +107,9 @@ func (test *TestContext) CreateAccount(accountBud *Account) (*Account, *ApiError
 
 func (test *TestContext) NewAccountBud() *Account {
 	accountBud := &Account{
-		Id:             uuid4s(),
-		OrganisationId: uuid4s(),
-		Attributes:     &AccountAttributes{Country: alpha2()},
+		Id:             uuid4s(test.Rand.Uint64),
+		OrganisationId: uuid4s(test.Rand.Uint64),
+		Attributes:     &AccountAttributes{Country: alpha2(test.Rand.Uint64)},
 	}
 	return accountBud
 }
@@ -62,15 +118,14 @@ func (test *TestContext) UpdateAccount(id string, updates *Account) (*Account, *
 	test.T.Logf("UpdateAccount(%s)", id)
 
 	if updates == nil {
-		rand.Seed(time.Now().UnixNano())
 		updates = &Account{
 			Id:             id,
-			OrganisationId: uuid4s(),
-			Attributes:     &AccountAttributes{Country: alpha2()},
+			OrganisationId: uuid4s(test.Rand.Uint64),
+			Attributes:     &AccountAttributes{Country: alpha2(test.Rand.Uint64)},
 		}
 	}
 
-	account, apiErr := test.Client.UpdateAccount(id, updates)
+	account, apiErr := test.Client.UpdateAccount(test.Ctx, id, updates)
 
 	if apiErr == nil {
 		if e := printJson(account); e != nil {
@@ -100,7 +155,7 @@ func (test *TestContext) CompareAccounts(acc *Account, bud *Account) {
 
 func TestListAccounts(t *testing.T) {
 	t.Log("TestListAccounts()")
-	test := NewTestContext(t)
+	test := newAccountsTestContext(t)
 	accountVersionMap, err := test.ListAccounts(nil)
 	if err != nil {
 		t.Fatal(err)
@@ -112,7 +167,7 @@ func TestListAccounts(t *testing.T) {
 func TestListAccountsFiltered(t *testing.T) {
 	filters := map[string]string{"country": "GB"}
 	t.Logf("TestListAccountsFiltered(%s)", fmt.Sprint(filters))
-	test := NewTestContext(t)
+	test := newAccountsTestContext(t)
 	accountVersionMap, err := test.ListAccounts(filters)
 	if err != nil {
 		t.Fatal(err)
@@ -123,7 +178,9 @@ func TestListAccountsFiltered(t *testing.T) {
 
 func TestCreateFetchAccount(t *testing.T) {
 	t.Log("TestCreateFetchAccount()")
-	test := NewTestContext(t)
+	test := newAccountsTestContext(t)
+	// Repeated creations are expected to return the existing account, the fake API has no Idempotency-Key support
+	test.Client.SetCreateMode(CreateProbeAndRefetch)
 
 	var account *Account
 	var err *ApiError
@@ -160,7 +217,7 @@ func TestCreateFetchAccount(t *testing.T) {
 
 func TestUpdateAccount(t *testing.T) {
 	t.Log("TestUpdateAccount()")
-	test := NewTestContext(t)
+	test := newAccountsTestContext(t)
 
 	origAccount, err := test.CreateAccount(nil)
 	if err != nil {
@@ -227,7 +284,7 @@ func TestUpdateAccount(t *testing.T) {
 
 func TestDeleteAccount(t *testing.T) {
 	t.Log("TestDeleteAccount()")
-	test := NewTestContext(t)
+	test := newAccountsTestContext(t)
 
 	account, err := test.CreateAccount(nil)
 	if err != nil {
@@ -272,7 +329,7 @@ func TestDeleteAccount(t *testing.T) {
 
 func TestFetchAccountPagination(t *testing.T) {
 	t.Log("TestFetchAccountPagination()")
-	test := NewTestContext(t)
+	test := newAccountsTestContext(t)
 	test.Client.SetPageSize(1011)
 
 	accountVersionMap, err := test.ListAccounts(nil)
@@ -308,8 +365,8 @@ func TestFetchAccountPagination(t *testing.T) {
 func TestDeleteAccount_no_id(t *testing.T) {
 	var id string
 	t.Log("TestDeleteAccount_no_id()")
-	test := NewTestContext(t)
-	apiErr := test.Client.DeleteAccount(id, 0)
+	test := newAccountsTestContext(t)
+	apiErr := test.Client.DeleteAccount(test.Ctx, id, 0)
 	if apiErr == nil {
 		t.Errorf("DeleteAccount(id, version) returned no error for empty id")
 	}
@@ -318,8 +375,8 @@ func TestDeleteAccount_no_id(t *testing.T) {
 func TestFetchAccount_no_id(t *testing.T) {
 	var id string
 	t.Log("TestFetchAccount_no_id()")
-	test := NewTestContext(t)
-	acc, apiErr := test.Client.FetchAccount(id)
+	test := newAccountsTestContext(t)
+	acc, apiErr := test.Client.FetchAccount(test.Ctx, id)
 	if apiErr == nil {
 		t.Errorf("FetchAccount(id) returned no error for empty id")
 	}
@@ -0,0 +1,186 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+)
+
+// ErrorCode of the ApiError returned by Do when a failed attempt would have been retried, but the request body
+// can not be replayed
+const ErrorCodeBodyNotReplayable = "body_not_replayable"
+
+// requestBody provides the body of each attempt of a request in Do, without buffering it
+type requestBody struct {
+	// The original body of the request
+	body io.ReadCloser
+	// Provides a fresh copy of the body, nil if the body can not be replayed
+	getBody func() (io.ReadCloser, error)
+	// Whether body shall not be passed to the transport (which would close it), as it's replayed by seeking
+	seeker bool
+	// Whether body was passed to the transport
+	sent bool
+}
+
+// newRequestBody prepares the body of req for the attempts of Do, returns nil if req has no body.
+//
+// The body is replayed through req.GetBody if set (as by http.NewRequest for in-memory readers, or by JsonRequest),
+// or from the current offset if the body is an io.Seeker (like an *os.File), which is then closed by close. Such a body
+// is read through an io.SectionReader if it's an io.ReaderAt, otherwise it's sought back on the first read of each
+// copy. Other bodies are sent only once, and req.GetBody is set accordingly for the middlewares.
+func newRequestBody(req *http.Request) (*requestBody, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	rb := &requestBody{body: req.Body, getBody: req.GetBody}
+
+	if rb.getBody == nil {
+		if seeker, ok := req.Body.(io.Seeker); ok {
+			offset, err := seeker.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return nil, err
+			}
+			rb.seeker = true
+			if readerAt, ok := req.Body.(io.ReaderAt); ok {
+				// Independent readers, so that peeking through GetBody doesn't drain the body of the attempt
+				rb.getBody = func() (io.ReadCloser, error) {
+					return ioutil.NopCloser(io.NewSectionReader(readerAt, offset, math.MaxInt64-offset)), nil
+				}
+			} else {
+				rb.getBody = func() (io.ReadCloser, error) {
+					return &seekingBody{Reader: rb.body, seeker: seeker, offset: offset}, nil
+				}
+			}
+			req.GetBody = rb.getBody
+		}
+	}
+	return rb, nil
+}
+
+// replayable tells whether the body can be sent again
+func (rb *requestBody) replayable() bool {
+	return rb == nil || rb.getBody != nil
+}
+
+// forAttempt returns the body of the attempt, the original body is passed to the first one (unless it's replayed by
+// seeking).
+//
+// With a seekable body which is not an io.ReaderAt the previous attempt may still be reading it when the transport
+// returns early, like on a response received before the request was fully written, so such a body shall not be
+// retried concurrently, nor read by a middleware while the transport reads it.
+func (rb *requestBody) forAttempt(attempt uint) (io.ReadCloser, error) {
+	if attempt == 1 && !rb.seeker {
+		rb.sent = true
+		return rb.body, nil
+	}
+	return rb.getBody()
+}
+
+// close closes the original body if it was kept from the transport, or if no attempt was made (like with an open
+// circuit), so that a streamed body doesn't leak its encoding goroutine
+func (rb *requestBody) close() error {
+	if rb == nil || rb.sent {
+		return nil
+	}
+	return rb.body.Close()
+}
+
+// seekingBody is a copy of a seekable body, seeking back to offset on its first read. Peeking at the body (through
+// GetBody) before the transport reads its own copy is thus harmless.
+type seekingBody struct {
+	io.Reader
+	seeker io.Seeker
+	offset int64
+	sought bool
+}
+
+// Implements io.Reader interface
+func (body *seekingBody) Read(p []byte) (int, error) {
+	if !body.sought {
+		if _, err := body.seeker.Seek(body.offset, io.SeekStart); err != nil {
+			return 0, err
+		}
+		body.sought = true
+	}
+	return body.Reader.Read(p)
+}
+
+// Implements io.Closer interface, the original body is closed by requestBody.close
+func (body *seekingBody) Close() error {
+	return nil
+}
+
+// requestBodyError is an error of producing a request body, like JSON encoding in a stream. Not to be retried.
+type requestBodyError struct {
+	err error
+}
+
+// Implements Error interface
+func (err *requestBodyError) Error() string {
+	return "request body: " + err.err.Error()
+}
+
+// Unwrap returns the underlying error
+func (err *requestBodyError) Unwrap() error {
+	return err.err
+}
+
+// jsonStream returns a reader of the JSON encoding of data, encoded on the fly (by a goroutine) as it gets read.
+// Closing the reader stops the encoding.
+func jsonStream(data interface{}) io.ReadCloser {
+	reader, writer := io.Pipe()
+	go func() {
+		if err := json.NewEncoder(writer).Encode(data); err != nil {
+			_ = writer.CloseWithError(&requestBodyError{err})
+			return
+		}
+		_ = writer.Close()
+	}()
+	return reader
+}
+
+// Tells whether JsonRequest streams the JSON encoding of request data
+func (client *ApiClient) StreamJson() bool {
+	return client.snapshot().streamJson
+}
+
+// Sets whether JsonRequest encodes request data straight into the request stream (true), instead of marshalling it in
+// memory first (the default). Streamed requests have no Content-Length (sent with chunked transfer encoding), and the
+// data is encoded again for each retry, so it shall not be modified during the request.
+func (client *ApiClient) SetStreamJson(stream bool) {
+	client.update(func(config *clientConfig) { config.streamJson = stream })
+}
+
+// limitedBody is a response body failing with *ResponseTooLargeError when read beyond the limit
+type limitedBody struct {
+	io.ReadCloser
+	limit     int64
+	remaining int64
+}
+
+// Implements io.Reader interface
+func (body *limitedBody) Read(p []byte) (int, error) {
+	if body.remaining < 0 {
+		return 0, &ResponseTooLargeError{Limit: body.limit}
+	}
+	if body.remaining == 0 {
+		// Probes whether there is more than the limit
+		var probe [1]byte
+		n, err := body.ReadCloser.Read(probe[:])
+		if n > 0 {
+			body.remaining = -1
+			return 0, &ResponseTooLargeError{Limit: body.limit}
+		}
+		return 0, err
+	}
+	if int64(len(p)) > body.remaining {
+		p = p[:body.remaining]
+	}
+	n, err := body.ReadCloser.Read(p)
+	body.remaining -= int64(n)
+	return n, err
+}
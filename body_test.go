@@ -0,0 +1,188 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// seekableBody is a seekable request body recording whether it got closed
+type seekableBody struct {
+	*strings.Reader
+	closed int32
+}
+
+func (body *seekableBody) Close() error {
+	atomic.AddInt32(&body.closed, 1)
+	return nil
+}
+
+// recordBodies returns a handler failing the first request with 502, recording the received bodies
+func recordBodies(t *testing.T, mu *sync.Mutex, bodies *[]string, lengths *[]int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("Failed reading request body: %s", err)
+		}
+		mu.Lock()
+		*bodies = append(*bodies, string(data))
+		*lengths = append(*lengths, r.ContentLength)
+		first := len(*bodies) == 1
+		mu.Unlock()
+
+		if first {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", ContentType+"; charset=utf-8")
+		_, _ = w.Write([]byte(`{"data":{}}`))
+	}
+}
+
+func TestDo_SeekableBodyReplayed(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	var lengths []int64
+	client, _ := newTestServer(t, recordBodies(t, &mu, &bodies, &lengths))
+	client.SetErrorBackOff(0)
+
+	body := &seekableBody{Reader: strings.NewReader("skipped|payload")}
+	if _, err := body.Seek(int64(len("skipped|")), io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	req, err := client.NewRequest(context.Background(), http.MethodPost, AccountsPath, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.ContentLength = int64(body.Len())
+
+	resp, apiErr := client.Do(context.Background(), req)
+	if apiErr != nil {
+		t.Fatalf("Do() failed: %s", apiErr)
+	}
+	_ = resp.Body.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodies) != 2 || bodies[0] != "payload" || bodies[1] != "payload" {
+		t.Errorf("Expected the body to be sent twice from its offset, received %q", bodies)
+	}
+	if closed := atomic.LoadInt32(&body.closed); closed != 1 {
+		t.Errorf("Expected the body to be closed once, closed %d times", closed)
+	}
+}
+
+func TestDo_NotReplayableBodyNotRetried(t *testing.T) {
+	var requests int32
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	client.SetErrorBackOff(0)
+
+	// io.MultiReader hides the Seek method and http.NewRequest can not set GetBody
+	body := io.MultiReader(bytes.NewReader([]byte("payload")))
+	req, err := client.NewRequest(context.Background(), http.MethodPost, AccountsPath, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, apiErr := client.Do(context.Background(), req)
+	if apiErr == nil {
+		t.Fatal("Do() returned no error")
+	}
+	if apiErr.ErrorCode != ErrorCodeBodyNotReplayable || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Unexpected error: %#v", apiErr)
+	}
+	if requests := atomic.LoadInt32(&requests); requests != 1 {
+		t.Errorf("Expected 1 request, received %d", requests)
+	}
+}
+
+func TestJsonRequest_Streamed(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	var lengths []int64
+	client, _ := newTestServer(t, recordBodies(t, &mu, &bodies, &lengths))
+	client.SetErrorBackOff(0)
+	client.SetStreamJson(true)
+
+	resp, _, apiErr := client.JsonRequest(context.Background(), http.MethodPost, AccountsPath,
+		map[string]string{"id": "1"})
+	if apiErr != nil {
+		t.Fatalf("JsonRequest() failed: %s", apiErr)
+	}
+	_ = resp.Body.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodies) != 2 || bodies[0] != "{\"id\":\"1\"}\n" || bodies[1] != bodies[0] {
+		t.Errorf("Expected the JSON body to be sent twice, received %q", bodies)
+	}
+	for _, length := range lengths {
+		if length != -1 {
+			t.Errorf("Expected streamed requests of unknown length, received Content-Length %d", length)
+		}
+	}
+}
+
+func TestJsonRequest_StreamEncodingFails(t *testing.T) {
+	var requests int32
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		_, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusBadRequest)
+	})
+	client.SetErrorBackOff(0)
+	client.SetStreamJson(true)
+
+	_, _, apiErr := client.JsonRequest(context.Background(), http.MethodPost, AccountsPath,
+		map[string]interface{}{"invalid": make(chan int)})
+	if apiErr == nil {
+		t.Fatal("JsonRequest() returned no error for data which can not be encoded")
+	}
+	if !strings.Contains(apiErr.Error(), "request body") {
+		t.Errorf("Expected a request body error, received %s", apiErr)
+	}
+	if requests := atomic.LoadInt32(&requests); requests > 1 {
+		t.Errorf("Expected no retries, received %d requests", requests)
+	}
+}
+
+func TestJsonRequest_StreamNotAdmitted(t *testing.T) {
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Request was sent through an open circuit")
+	})
+	client.SetStreamJson(true)
+	cb := NewCircuitBreaker(CircuitBreakerSettings{Window: 1, MinRequests: 1, OpenDuration: time.Minute})
+	done, _ := cb.Allow()
+	done(true)
+	client.SetCircuitBreaker(cb)
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		_, _, apiErr := client.JsonRequest(context.Background(), http.MethodPost, AccountsPath,
+			map[string]string{"id": "1"})
+		if apiErr == nil || apiErr.ErrorCode != ErrorCodeCircuitOpen {
+			t.Fatalf("Expected circuit open error, got %v", apiErr)
+		}
+	}
+	// The encoding goroutines of the streams exit once the bodies are closed
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > before+10 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before+10 {
+		t.Errorf("Streamed bodies leaked goroutines: %d before, %d after", before, after)
+	}
+}
@@ -0,0 +1,218 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrorCode of the ApiError returned by Do while the circuit breaker is open
+const ErrorCodeCircuitOpen = "circuit_open"
+
+// Error of the attempts refused by the circuit breaker
+var errCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitState is the state of a CircuitBreaker
+type CircuitState int
+
+const (
+	// Requests pass, outcomes are counted
+	CircuitClosed CircuitState = iota
+	// Requests fail fast
+	CircuitOpen
+	// A limited number of probe requests pass to decide whether to close or re-open
+	CircuitHalfOpen
+)
+
+// Implements fmt.Stringer interface
+func (state CircuitState) String() string {
+	switch state {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("CircuitState(%d)", int(state))
+}
+
+// CircuitBreakerSettings configure a CircuitBreaker, zero values are replaced by defaults
+type CircuitBreakerSettings struct {
+	// Number of the most recent attempts considered (default 20)
+	Window int
+	// Opens when the ratio of failures in the window reaches this (default 0.5)
+	FailureRatio float64
+	// Does not open before this many attempts are in the window (default 10)
+	MinRequests int
+	// Stays open this long before letting probes through (default 30s)
+	OpenDuration time.Duration
+	// Number of successful probes needed to close, also the number of concurrent probes allowed (default 1)
+	HalfOpenProbes int
+}
+
+// CircuitBreaker fails requests fast when the API seems to be down, instead of spending all the retries and timeouts.
+//
+// Transport errors and 5xx responses count as failures (but not cancellation by the caller). When the failure ratio of
+// the recent attempts reaches the threshold, the breaker opens for OpenDuration, then lets HalfOpenProbes probes
+// through: it closes if all of them succeed and re-opens on any failure. Safe for concurrent use.
+type CircuitBreaker struct {
+	settings CircuitBreakerSettings
+
+	mu    sync.Mutex
+	state CircuitState
+	// Ring buffer of the outcomes in the window, true is failure
+	outcomes []bool
+	next     int
+	count    int
+	failures int
+	// When the breaker opened
+	openedAt time.Time
+	// Probes let through and succeeded while half-open
+	probes         int
+	probeSuccesses int
+	// Incremented on each state change, outcomes of attempts allowed in an earlier generation are ignored
+	generation uint64
+}
+
+// NewCircuitBreaker creates a closed CircuitBreaker
+func NewCircuitBreaker(settings CircuitBreakerSettings) *CircuitBreaker {
+	if settings.Window <= 0 {
+		settings.Window = 20
+	}
+	if settings.FailureRatio <= 0 {
+		settings.FailureRatio = 0.5
+	}
+	if settings.MinRequests <= 0 {
+		settings.MinRequests = 10
+	}
+	if settings.OpenDuration <= 0 {
+		settings.OpenDuration = 30 * time.Second
+	}
+	if settings.HalfOpenProbes <= 0 {
+		settings.HalfOpenProbes = 1
+	}
+	return &CircuitBreaker{settings: settings, outcomes: make([]bool, settings.Window)}
+}
+
+// State returns the current state, for health checks
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.expire(time.Now())
+	return cb.state
+}
+
+// Allow tells whether an attempt may proceed. If so, done shall be invoked with the outcome of the attempt.
+func (cb *CircuitBreaker) Allow() (done func(failure bool), allowed bool) {
+	done, _, allowed = cb.allow()
+	return done, allowed
+}
+
+// allow is Allow, also returning release to give the permission back when the attempt is not made after all (instead
+// of done), so that a half-open probe slot is not lost
+func (cb *CircuitBreaker) allow() (done func(failure bool), release func(), allowed bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.expire(time.Now())
+
+	switch cb.state {
+	case CircuitOpen:
+		return nil, nil, false
+	case CircuitHalfOpen:
+		if cb.probes >= cb.settings.HalfOpenProbes {
+			return nil, nil, false
+		}
+		cb.probes++
+	}
+
+	generation := cb.generation
+	var once sync.Once
+	return func(failure bool) {
+			once.Do(func() { cb.record(generation, failure) })
+		}, func() {
+			once.Do(func() { cb.release(generation) })
+		}, true
+}
+
+// release gives back a probe slot of an attempt not made
+func (cb *CircuitBreaker) release(generation uint64) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if generation == cb.generation && cb.state == CircuitHalfOpen && cb.probes > 0 {
+		cb.probes--
+	}
+}
+
+// record counts the outcome of an attempt
+func (cb *CircuitBreaker) record(generation uint64, failure bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if generation != cb.generation {
+		return
+	}
+
+	switch cb.state {
+	case CircuitClosed:
+		if cb.count == len(cb.outcomes) {
+			if cb.outcomes[cb.next] {
+				cb.failures--
+			}
+		} else {
+			cb.count++
+		}
+		cb.outcomes[cb.next] = failure
+		cb.next = (cb.next + 1) % len(cb.outcomes)
+		if failure {
+			cb.failures++
+		}
+		if cb.count >= cb.settings.MinRequests &&
+			float64(cb.failures) >= cb.settings.FailureRatio*float64(cb.count) {
+			cb.setState(CircuitOpen, time.Now())
+		}
+
+	case CircuitHalfOpen:
+		if failure {
+			cb.setState(CircuitOpen, time.Now())
+			return
+		}
+		cb.probeSuccesses++
+		if cb.probeSuccesses >= cb.settings.HalfOpenProbes {
+			cb.setState(CircuitClosed, time.Now())
+		}
+	}
+}
+
+// expire moves from open to half-open after OpenDuration, must hold cb.mu
+func (cb *CircuitBreaker) expire(now time.Time) {
+	if cb.state == CircuitOpen && now.Sub(cb.openedAt) >= cb.settings.OpenDuration {
+		cb.setState(CircuitHalfOpen, now)
+	}
+}
+
+// setState switches state and resets the counters, must hold cb.mu
+func (cb *CircuitBreaker) setState(state CircuitState, now time.Time) {
+	cb.state = state
+	cb.generation++
+	cb.probes, cb.probeSuccesses = 0, 0
+	if state == CircuitOpen {
+		cb.openedAt = now
+	}
+	if state == CircuitClosed {
+		cb.next, cb.count, cb.failures = 0, 0, 0
+	}
+}
+
+// Gets the CircuitBreaker of the client, or nil
+func (client *ApiClient) CircuitBreaker() *CircuitBreaker {
+	return client.snapshot().circuitBreaker
+}
+
+// Sets a CircuitBreaker guarding the attempts of Do, nil disables it.
+// A CircuitBreaker may be shared by multiple clients of the same API.
+func (client *ApiClient) SetCircuitBreaker(cb *CircuitBreaker) {
+	client.update(func(config *clientConfig) { config.circuitBreaker = cb })
+}
@@ -0,0 +1,173 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker_States(t *testing.T) {
+	cb := NewCircuitBreaker(CircuitBreakerSettings{
+		Window: 4, FailureRatio: 0.5, MinRequests: 4, OpenDuration: 50 * time.Millisecond, HalfOpenProbes: 1,
+	})
+
+	for i, failure := range []bool{false, true, false} {
+		done, allowed := cb.Allow()
+		if !allowed {
+			t.Fatalf("Attempt #%d should be allowed while closed", i)
+		}
+		done(failure)
+	}
+	if cb.State() != CircuitClosed {
+		t.Fatal("Breaker should stay closed below MinRequests")
+	}
+
+	done, _ := cb.Allow()
+	done(true)
+	if cb.State() != CircuitOpen {
+		t.Fatalf("Breaker should open at failure ratio 0.5, is %s", cb.State())
+	}
+	if _, allowed := cb.Allow(); allowed {
+		t.Fatal("Attempts should fail fast while open")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if cb.State() != CircuitHalfOpen {
+		t.Fatalf("Breaker should be half-open after OpenDuration, is %s", cb.State())
+	}
+	probe, allowed := cb.Allow()
+	if !allowed {
+		t.Fatal("A probe should be allowed while half-open")
+	}
+	if _, allowed := cb.Allow(); allowed {
+		t.Fatal("Only HalfOpenProbes probes should be allowed at once")
+	}
+	probe(true)
+	if cb.State() != CircuitOpen {
+		t.Fatalf("Failed probe should re-open the breaker, is %s", cb.State())
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	probe, _ = cb.Allow()
+	probe(false)
+	if cb.State() != CircuitClosed {
+		t.Fatalf("Successful probe should close the breaker, is %s", cb.State())
+	}
+}
+
+func TestDo_CircuitBreaker(t *testing.T) {
+	var requests int32
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	client.SetRetries(5)
+	client.SetErrorBackOff(0)
+	client.SetCircuitBreaker(NewCircuitBreaker(CircuitBreakerSettings{MinRequests: 2, OpenDuration: time.Minute}))
+
+	req, err := client.NewRequest(context.Background(), http.MethodGet, AccountsPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, apiErr := client.Do(context.Background(), req)
+	if apiErr == nil || apiErr.ErrorCode != ErrorCodeCircuitOpen {
+		t.Fatalf("Expected circuit open error, got %v", apiErr)
+	}
+	if requests := atomic.LoadInt32(&requests); requests != 2 {
+		t.Errorf("Retries should stop when the breaker opens, received %d requests", requests)
+	}
+	if state := client.CircuitBreaker().State(); state != CircuitOpen {
+		t.Errorf("Breaker should be open, is %s", state)
+	}
+}
+
+// countingLimiter is a RateLimiter counting the calls of Wait, which block until ctx is done beyond the first free
+type countingLimiter struct {
+	waits int32
+	free  int32
+}
+
+// Implements RateLimiter interface
+func (limiter *countingLimiter) Wait(ctx context.Context) error {
+	if atomic.AddInt32(&limiter.waits, 1) > limiter.free {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return nil
+}
+
+// Implements RateLimiter interface
+func (limiter *countingLimiter) Observe(*http.Response) {}
+
+func TestDo_CircuitBreakerBeforeRateLimiter(t *testing.T) {
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Request was sent through an open circuit")
+	})
+	cb := NewCircuitBreaker(CircuitBreakerSettings{Window: 1, MinRequests: 1, OpenDuration: 50 * time.Millisecond})
+	done, _ := cb.Allow()
+	done(true)
+	client.SetCircuitBreaker(cb)
+	limiter := &countingLimiter{}
+	client.SetRateLimiter(limiter)
+
+	req, err := client.NewRequest(context.Background(), http.MethodGet, AccountsPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, apiErr := client.Do(context.Background(), req)
+	if apiErr == nil || apiErr.ErrorCode != ErrorCodeCircuitOpen {
+		t.Fatalf("Expected circuit open error, got %v", apiErr)
+	}
+	if waits := atomic.LoadInt32(&limiter.waits); waits != 0 {
+		t.Errorf("The rate limiter was waited for %d times while the circuit was open", waits)
+	}
+
+	// A probe given up while waiting for the rate limiter doesn't hold the half-open slot
+	time.Sleep(60 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, apiErr := client.Do(ctx, req); apiErr == nil || !errors.Is(apiErr, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline exceeded error, got %v", apiErr)
+	}
+	if _, allowed := cb.Allow(); !allowed {
+		t.Error("The probe slot was not released")
+	}
+}
+
+func TestDo_CircuitBreakerCancelledProbe(t *testing.T) {
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	client.SetRetries(1)
+	cb := NewCircuitBreaker(CircuitBreakerSettings{Window: 1, MinRequests: 1, OpenDuration: 20 * time.Millisecond})
+	done, _ := cb.Allow()
+	done(true)
+	client.SetCircuitBreaker(cb)
+	time.Sleep(30 * time.Millisecond)
+
+	// The probe is cancelled by the deadline of the caller, that's not a success of the API
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, err := client.NewRequest(ctx, http.MethodGet, AccountsPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, apiErr := client.Do(ctx, req); apiErr == nil {
+		t.Fatal("Do() succeeded")
+	}
+	if state := cb.State(); state != CircuitHalfOpen {
+		t.Errorf("Breaker should stay half-open, is %s", state)
+	}
+	if _, allowed := cb.Allow(); !allowed {
+		t.Error("The probe slot was not released")
+	}
+}
@@ -0,0 +1,67 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// ErrorCode of the ApiError returned by Do when the overall budget of the operation ran out (see SetBudget)
+const ErrorCodeBudgetExhausted = "budget_exhausted"
+
+// budgetContext returns ctx bound to the deadline of the budget (zero time if there's no budget) and its cancel
+func (config *clientConfig) budgetContext(ctx context.Context) (context.Context, time.Time, context.CancelFunc) {
+	if config.budget <= 0 {
+		return ctx, time.Time{}, func() {}
+	}
+	deadline := time.Now().Add(config.budget)
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	return ctx, deadline, cancel
+}
+
+// attemptEstimate estimates how long a retry takes: as long as the last attempt (elapsed), but at most Timeout
+func (config *clientConfig) attemptEstimate(elapsed time.Duration) time.Duration {
+	if timeout := config.httpClient.Timeout; timeout > 0 && timeout < elapsed {
+		return timeout
+	}
+	return elapsed
+}
+
+// budgetExhausted tells whether ctx, bound to the budget, ended because of the budget rather than the parent context
+func budgetExhausted(parent, ctx context.Context) bool {
+	return parent.Err() == nil && ctx.Err() == context.DeadlineExceeded
+}
+
+// newBudgetError creates the ApiError of an exhausted budget, with the error (err, or the response) of the last attempt
+func newBudgetError(resp *http.Response, err error, budget time.Duration, attempts uint) *ApiError {
+	var last *ApiError
+	if err != nil {
+		last = NewApiError(resp, err.Error())
+	} else {
+		last = NewApiError(resp, "Received unexpected HTTP status code %s", resp.Status)
+	}
+	apiErr := NewApiError(nil, "Budget of %s exhausted after %d attempt(s), last error: %s",
+		budget, attempts, last.ErrorMessage)
+	apiErr.StatusCode = last.StatusCode
+	apiErr.ErrorCode = ErrorCodeBudgetExhausted
+	apiErr.Err = err
+	return apiErr
+}
+
+// Gets the overall budget of an operation spanning all the attempts, 0 if unlimited
+func (client *ApiClient) Budget() time.Duration {
+	return client.snapshot().budget
+}
+
+// Sets the overall budget of an operation spanning all the attempts and the delays between them, 0 disables it
+// (default). While Timeout applies to each attempt, an attempt is also limited by the remaining budget, and no retry is
+// started which couldn't finish within the budget: the back-off delay plus the estimated length of the attempt (as long
+// as the last attempt, but at most Timeout) has to fit in. An operation stopped by the budget fails with an
+// ApiError of ErrorCode ErrorCodeBudgetExhausted, otherwise with the error of the last attempt.
+//
+// The budget includes reading the response body, it ends when the body is closed.
+func (client *ApiClient) SetBudget(budget time.Duration) {
+	client.update(func(config *clientConfig) { config.budget = budget })
+}
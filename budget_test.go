@@ -0,0 +1,159 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBudget_SlowAttempt(t *testing.T) {
+	var requests int32
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+	client.SetRetries(5)
+	client.SetErrorBackOff(0)
+	client.SetTimeout(10 * time.Second)
+	client.SetBudget(100 * time.Millisecond)
+
+	start := time.Now()
+	_, apiErr := client.FetchAccount(context.Background(), "1")
+	if apiErr == nil {
+		t.Fatal("FetchAccount() succeeded")
+	}
+	if apiErr.ErrorCode != ErrorCodeBudgetExhausted {
+		t.Errorf("Unexpected error: %s (%s)", apiErr, apiErr.ErrorCode)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("The attempt was not limited by the budget, took %v", elapsed)
+	}
+	if requests := atomic.LoadInt32(&requests); requests != 1 {
+		t.Errorf("Expected 1 request, received %d", requests)
+	}
+}
+
+func TestBudget_NoRetryBeyondBudget(t *testing.T) {
+	var requests int32
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		time.Sleep(60 * time.Millisecond)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	client.SetRetries(10)
+	// Attempts start 80ms apart and take 60ms: the 3rd ends at 220ms, a 4th could start but not finish
+	client.SetErrorBackOff(80 * time.Millisecond)
+	client.SetBudget(260 * time.Millisecond)
+
+	_, apiErr := client.FetchAccount(context.Background(), "1")
+	if apiErr == nil {
+		t.Fatal("FetchAccount() succeeded")
+	}
+	if apiErr.ErrorCode != ErrorCodeBudgetExhausted || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Unexpected error: %s (%s, %d)", apiErr, apiErr.ErrorCode, apiErr.StatusCode)
+	}
+	if requests := atomic.LoadInt32(&requests); requests != 3 {
+		t.Errorf("Expected 3 requests within the budget, received %d", requests)
+	}
+}
+
+func TestBudget_AttemptsFailed(t *testing.T) {
+	var requests int32
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	client.SetRetries(3)
+	client.SetErrorBackOff(0)
+	client.SetBudget(5 * time.Second)
+
+	_, apiErr := client.FetchAccount(context.Background(), "1")
+	if apiErr == nil {
+		t.Fatal("FetchAccount() succeeded")
+	}
+	if apiErr.ErrorCode == ErrorCodeBudgetExhausted || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Unexpected error: %s (%s, %d)", apiErr, apiErr.ErrorCode, apiErr.StatusCode)
+	}
+	if requests := atomic.LoadInt32(&requests); requests != 3 {
+		t.Errorf("Expected 3 requests, received %d", requests)
+	}
+}
+
+func TestBudget_ResponseBodyReadable(t *testing.T) {
+	var cancelled int32
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		_, _ = w.Write([]byte(`{"data":{"id":"1"}}`))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+		atomic.AddInt32(&cancelled, 1)
+	})
+	client.SetBudget(5 * time.Second)
+
+	req, err := http.NewRequest(http.MethodGet, client.BaseURL()+AccountsPath+"/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, apiErr := client.Do(context.Background(), req)
+	if apiErr != nil {
+		t.Fatalf("Do() failed: %s", apiErr)
+	}
+	buf := make([]byte, 8)
+	if _, err := resp.Body.Read(buf); err != nil {
+		t.Fatalf("Reading the response body failed: %s", err)
+	}
+
+	// Closing the body ends the budget, cancelling the request
+	_ = resp.Body.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt32(&cancelled) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if atomic.LoadInt32(&cancelled) != 1 {
+		t.Error("The request was not cancelled on closing the body")
+	}
+}
+
+// closeRecordingBody is a response body counting its closes
+type closeRecordingBody struct {
+	io.ReadCloser
+	closed *int32
+}
+
+// Implements io.Closer interface
+func (body closeRecordingBody) Close() error {
+	atomic.AddInt32(body.closed, 1)
+	return body.ReadCloser.Close()
+}
+
+func TestBudget_DeleteAccountClosesBody(t *testing.T) {
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	client.SetBudget(5 * time.Second)
+	var closed int32
+	client.Use(func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			resp, err := next.RoundTrip(req)
+			if resp != nil {
+				resp.Body = closeRecordingBody{resp.Body, &closed}
+			}
+			return resp, err
+		})
+	})
+
+	if apiErr := client.DeleteAccount(context.Background(), "1", 0); apiErr != nil {
+		t.Fatalf("DeleteAccount() failed: %s", apiErr)
+	}
+	if closed := atomic.LoadInt32(&closed); closed != 1 {
+		t.Errorf("Expected the response body to be closed once, closed %d times", closed)
+	}
+}
@@ -0,0 +1,191 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CacheSettings configure an AccountCache, zero values are replaced by defaults
+type CacheSettings struct {
+	// Maximum number of accounts kept, the least recently used is evicted first (default 1000)
+	Size int
+	// Accounts are served from the cache without a request for this long (default 30s)
+	TTL time.Duration
+}
+
+// CacheStats are the statistics of an AccountCache
+type CacheStats struct {
+	// Fetches served from the cache without a request
+	Hits uint64
+	// Fetches requesting the account, including the conditional requests
+	Misses uint64
+	// Conditional requests confirming that the cached account is not modified (304)
+	Revalidations uint64
+	// Entries evicted to keep the size
+	Evictions uint64
+	// Number of cached accounts
+	Entries int
+}
+
+// AccountCache is a read-through cache of FetchAccount, bounded in size (LRU) with a TTL.
+//
+// Expired entries received with an ETag or Last-Modified header are revalidated with a conditional request
+// (If-None-Match, If-Modified-Since), other expired entries are fetched again. Successful UpdateAccount and
+// DeleteAccount calls of the client update or evict the entries. Safe for concurrent use.
+type AccountCache struct {
+	settings CacheSettings
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// Elements of *cacheEntry, the most recently used in front
+	lru   *list.List
+	stats CacheStats
+}
+
+// cacheEntry is an account cached by AccountCache
+type cacheEntry struct {
+	account      *Account
+	etag         string
+	lastModified string
+	expires      time.Time
+}
+
+// NewAccountCache creates an empty AccountCache
+func NewAccountCache(settings CacheSettings) *AccountCache {
+	if settings.Size <= 0 {
+		settings.Size = 1000
+	}
+	if settings.TTL <= 0 {
+		settings.TTL = 30 * time.Second
+	}
+	return &AccountCache{settings: settings, entries: make(map[string]*list.Element), lru: list.New()}
+}
+
+// Stats returns the statistics of the cache
+func (cache *AccountCache) Stats() CacheStats {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	stats := cache.stats
+	stats.Entries = cache.lru.Len()
+	return stats
+}
+
+// Evict removes the account of id from the cache
+func (cache *AccountCache) Evict(id string) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if element, ok := cache.entries[id]; ok {
+		cache.lru.Remove(element)
+		delete(cache.entries, id)
+	}
+}
+
+// lookup returns a copy of the cached account of id if it's fresh (counted as a hit), otherwise counts a miss and
+// returns the validators of the stale entry for a conditional request (in header, nil if there are none).
+func (cache *AccountCache) lookup(id string) (*Account, http.Header) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	element, ok := cache.entries[id]
+	if !ok {
+		cache.stats.Misses++
+		return nil, nil
+	}
+	cache.lru.MoveToFront(element)
+	entry := element.Value.(*cacheEntry)
+	if time.Now().Before(entry.expires) {
+		cache.stats.Hits++
+		return copyAccount(entry.account), nil
+	}
+
+	cache.stats.Misses++
+	if entry.etag == "" && entry.lastModified == "" {
+		return nil, nil
+	}
+	header := http.Header{}
+	if entry.etag != "" {
+		header.Set("If-None-Match", entry.etag)
+	}
+	if entry.lastModified != "" {
+		header.Set("If-Modified-Since", entry.lastModified)
+	}
+	return nil, header
+}
+
+// revalidated renews the entry of id after a 304 response and returns a copy of its account, nil if it's gone
+func (cache *AccountCache) revalidated(id string, resp *http.Response) *Account {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	element, ok := cache.entries[id]
+	if !ok {
+		return nil
+	}
+	cache.stats.Revalidations++
+	entry := element.Value.(*cacheEntry)
+	entry.expires = time.Now().Add(cache.settings.TTL)
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		entry.etag = etag
+	}
+	if lastModified := resp.Header.Get("Last-Modified"); lastModified != "" {
+		entry.lastModified = lastModified
+	}
+	return copyAccount(entry.account)
+}
+
+// store caches a copy of account with the validators of resp
+func (cache *AccountCache) store(account *Account, resp *http.Response) {
+	if account == nil || account.Id == "" {
+		return
+	}
+	entry := &cacheEntry{
+		account:      copyAccount(account),
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+		expires:      time.Now().Add(cache.settings.TTL),
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if element, ok := cache.entries[account.Id]; ok {
+		element.Value = entry
+		cache.lru.MoveToFront(element)
+		return
+	}
+	cache.entries[account.Id] = cache.lru.PushFront(entry)
+	for cache.lru.Len() > cache.settings.Size {
+		oldest := cache.lru.Back()
+		cache.lru.Remove(oldest)
+		delete(cache.entries, oldest.Value.(*cacheEntry).account.Id)
+		cache.stats.Evictions++
+	}
+}
+
+// copyAccount returns a deep copy of account, so the cached accounts can't be modified by the callers
+func copyAccount(account *Account) *Account {
+	if account == nil {
+		return nil
+	}
+	dup := *account
+	if account.Attributes != nil {
+		attributes := *account.Attributes
+		attributes.AlternativeBankAccountNames = append([]string(nil), attributes.AlternativeBankAccountNames...)
+		dup.Attributes = &attributes
+	}
+	return &dup
+}
+
+// Gets the AccountCache of the client, or nil
+func (client *ApiClient) AccountCache() *AccountCache {
+	return client.snapshot().cache
+}
+
+// Sets an AccountCache for FetchAccount, nil disables caching.
+// An AccountCache may be shared by multiple clients of the same API.
+func (client *ApiClient) SetAccountCache(cache *AccountCache) {
+	client.update(func(config *clientConfig) { config.cache = cache })
+}
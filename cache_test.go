@@ -0,0 +1,156 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newCacheTestServer serves accounts with an ETag of their version, counting the GET requests and the 304 responses
+func newCacheTestServer(t *testing.T, version *uint32, gets, notModified *int32) *ApiClient {
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		etag := fmt.Sprintf(`"%d"`, atomic.LoadUint32(version))
+		switch r.Method {
+		case http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case http.MethodGet:
+			atomic.AddInt32(gets, 1)
+			if r.Header.Get("If-None-Match") == etag {
+				atomic.AddInt32(notModified, 1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", ContentType)
+		w.Header().Set("ETag", etag)
+		_, _ = fmt.Fprintf(w, `{"data":{"id":"%s","version":%d,"attributes":{"country":"GB"}}}`,
+			r.URL.Path[len("/"+AccountsPath+"/"):], atomic.LoadUint32(version))
+	})
+	return client
+}
+
+func TestAccountCache_HitsAndMisses(t *testing.T) {
+	var version uint32
+	var gets, notModified int32
+	client := newCacheTestServer(t, &version, &gets, &notModified)
+	cache := NewAccountCache(CacheSettings{})
+	client.SetAccountCache(cache)
+
+	for i := 0; i < 3; i++ {
+		account, apiErr := client.FetchAccount(context.Background(), "1")
+		if apiErr != nil {
+			t.Fatalf("FetchAccount() failed: %s", apiErr)
+		}
+		if account.Id != "1" || account.Attributes.Country != "GB" {
+			t.Fatalf("Unexpected account: %v", account)
+		}
+		// Modifying the returned account does not affect the cache
+		account.Attributes.Country = "HU"
+	}
+	if gets := atomic.LoadInt32(&gets); gets != 1 {
+		t.Errorf("Expected 1 request, received %d", gets)
+	}
+	if stats := cache.Stats(); stats != (CacheStats{Hits: 2, Misses: 1, Entries: 1}) {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestAccountCache_Revalidation(t *testing.T) {
+	var version uint32
+	var gets, notModified int32
+	client := newCacheTestServer(t, &version, &gets, &notModified)
+	cache := NewAccountCache(CacheSettings{TTL: time.Millisecond})
+	client.SetAccountCache(cache)
+
+	if _, apiErr := client.FetchAccount(context.Background(), "1"); apiErr != nil {
+		t.Fatalf("FetchAccount() failed: %s", apiErr)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	// Not modified
+	account, apiErr := client.FetchAccount(context.Background(), "1")
+	if apiErr != nil {
+		t.Fatalf("FetchAccount() failed: %s", apiErr)
+	}
+	if account.Id != "1" || account.Version != 0 {
+		t.Errorf("Unexpected account: %v", account)
+	}
+	if notModified := atomic.LoadInt32(&notModified); notModified != 1 {
+		t.Errorf("Expected 1 revalidation, received %d", notModified)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	// Modified
+	atomic.StoreUint32(&version, 1)
+	if account, apiErr = client.FetchAccount(context.Background(), "1"); apiErr != nil {
+		t.Fatalf("FetchAccount() failed: %s", apiErr)
+	}
+	if account.Version != 1 {
+		t.Errorf("Expected the modified account, received %v", account)
+	}
+	if stats := cache.Stats(); stats != (CacheStats{Misses: 3, Revalidations: 1, Entries: 1}) {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestAccountCache_UpdateAndDelete(t *testing.T) {
+	var version uint32
+	var gets, notModified int32
+	client := newCacheTestServer(t, &version, &gets, &notModified)
+	cache := NewAccountCache(CacheSettings{})
+	client.SetAccountCache(cache)
+
+	if _, apiErr := client.FetchAccount(context.Background(), "1"); apiErr != nil {
+		t.Fatalf("FetchAccount() failed: %s", apiErr)
+	}
+
+	// The updated account is cached
+	atomic.StoreUint32(&version, 1)
+	update := &Account{Id: "1", OrganisationId: uuid4s(rand.Uint64), Attributes: &AccountAttributes{Country: "GB"}}
+	if _, apiErr := client.UpdateAccount(context.Background(), "1", update); apiErr != nil {
+		t.Fatalf("UpdateAccount() failed: %s", apiErr)
+	}
+	account, apiErr := client.FetchAccount(context.Background(), "1")
+	if apiErr != nil {
+		t.Fatalf("FetchAccount() failed: %s", apiErr)
+	}
+	if account.Version != 1 {
+		t.Errorf("Expected the updated account, received %v", account)
+	}
+	if gets := atomic.LoadInt32(&gets); gets != 1 {
+		t.Errorf("Expected 1 GET request, received %d", gets)
+	}
+
+	// The deleted account is evicted
+	if apiErr := client.DeleteAccount(context.Background(), "1", 1); apiErr != nil {
+		t.Fatalf("DeleteAccount() failed: %s", apiErr)
+	}
+	if stats := cache.Stats(); stats.Entries != 0 {
+		t.Errorf("Deleted account is still cached: %+v", stats)
+	}
+}
+
+func TestAccountCache_LRU(t *testing.T) {
+	var version uint32
+	var gets, notModified int32
+	client := newCacheTestServer(t, &version, &gets, &notModified)
+	cache := NewAccountCache(CacheSettings{Size: 2})
+	client.SetAccountCache(cache)
+
+	for _, id := range []string{"1", "2", "1", "3", "1", "2"} {
+		if _, apiErr := client.FetchAccount(context.Background(), id); apiErr != nil {
+			t.Fatalf("FetchAccount() failed: %s", apiErr)
+		}
+	}
+	// 2 is evicted by 3, as 1 was used more recently
+	if stats := cache.Stats(); stats != (CacheStats{Hits: 2, Misses: 4, Evictions: 2, Entries: 2}) {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
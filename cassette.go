@@ -0,0 +1,257 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// CassetteMode is the mode of a Cassette
+type CassetteMode int
+
+const (
+	// Requests are served from the cassette offline
+	CassetteReplay CassetteMode = iota
+	// Requests pass to the API, and the exchanges are appended to the cassette
+	CassetteRecord
+)
+
+// ParseCassetteMode parses "replay" or "record"
+func ParseCassetteMode(mode string) (CassetteMode, error) {
+	switch mode {
+	case "replay":
+		return CassetteReplay, nil
+	case "record":
+		return CassetteRecord, nil
+	}
+	return 0, fmt.Errorf("unknown cassette mode %q", mode)
+}
+
+// Implements fmt.Stringer interface
+func (mode CassetteMode) String() string {
+	if mode == CassetteRecord {
+		return "record"
+	}
+	return "replay"
+}
+
+// Cassette is a Middleware recording the HTTP exchanges into a JSONL file (one exchange per line), or replaying them
+// offline from the file.
+//
+// Exchanges are matched on method, path, query, body and scope (see WithCassetteScope), not on the host, so a cassette
+// recorded against one base URL can be replayed with any base URL of the same path. Repeated requests get the recorded
+// responses in order, each recorded exchange is replayed once. A request without a recorded exchange fails with a
+// transport error. Transport errors are not recorded. Safe for concurrent use.
+//
+//	cassette, err := NewCassette("testdata/accounts.jsonl", CassetteReplay)
+//	client.Use(cassette.Middleware)
+type Cassette struct {
+	mode CassetteMode
+
+	mu sync.Mutex
+	// The file being recorded
+	file *os.File
+	// Recorded exchanges to replay, and whether they were replayed
+	exchanges []*cassetteExchange
+	replayed  []bool
+}
+
+// cassetteExchange is a line of a cassette
+type cassetteExchange struct {
+	Request  cassetteRequest  `json:"request"`
+	Response cassetteResponse `json:"response"`
+}
+
+// Scope is the one of the context of the request (see WithCassetteScope). Bodies which are not valid UTF-8 (like gzip
+// compressed ones) are base64 encoded, with BodyEncoding "base64"
+type cassetteRequest struct {
+	Scope        string `json:"scope,omitempty"`
+	Method       string `json:"method"`
+	Path         string `json:"path"`
+	Query        string `json:"query,omitempty"`
+	Body         string `json:"body,omitempty"`
+	BodyEncoding string `json:"body_encoding,omitempty"`
+}
+
+type cassetteResponse struct {
+	StatusCode   int         `json:"status_code"`
+	Header       http.Header `json:"header,omitempty"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"body_encoding,omitempty"`
+}
+
+// NewCassette opens the cassette file of name. In CassetteRecord mode exchanges are appended to the file (created if
+// missing), in CassetteReplay mode the file is loaded.
+func NewCassette(name string, mode CassetteMode) (*Cassette, error) {
+	cassette := &Cassette{mode: mode}
+	if mode == CassetteRecord {
+		file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		cassette.file = file
+		return cassette, nil
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 64<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var exchange cassetteExchange
+		if err := json.Unmarshal(scanner.Bytes(), &exchange); err != nil {
+			return nil, fmt.Errorf("invalid cassette %s line %d: %s", name, line, err)
+		}
+		cassette.exchanges = append(cassette.exchanges, &exchange)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	cassette.replayed = make([]bool, len(cassette.exchanges))
+	return cassette, nil
+}
+
+// Mode returns the mode of the cassette
+func (cassette *Cassette) Mode() CassetteMode {
+	return cassette.mode
+}
+
+// Close closes the file being recorded
+func (cassette *Cassette) Close() error {
+	cassette.mu.Lock()
+	defer cassette.mu.Unlock()
+	if cassette.file == nil {
+		return nil
+	}
+	err := cassette.file.Close()
+	cassette.file = nil
+	return err
+}
+
+// Middleware records or replays each attempt passing through it
+func (cassette *Cassette) Middleware(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		request, err := newCassetteRequest(req)
+		if err != nil {
+			return nil, err
+		}
+		if cassette.mode == CassetteReplay {
+			return cassette.replay(req, request)
+		}
+
+		resp, err := next.RoundTrip(req)
+		if err != nil {
+			return resp, err
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		exchange := cassetteExchange{
+			Request:  request,
+			Response: cassetteResponse{StatusCode: resp.StatusCode, Header: resp.Header},
+		}
+		exchange.Response.Body, exchange.Response.BodyEncoding = harText(body)
+		if err := cassette.record(&exchange); err != nil {
+			return nil, fmt.Errorf("recording cassette failed: %s", err)
+		}
+		return resp, nil
+	})
+}
+
+// Context key type of the cassette scope
+type cassetteScopeKey struct{}
+
+// WithCassetteScope returns a copy of ctx whose requests are recorded with scope (like the name of a test), and
+// replayed only from the exchanges of the same scope. This lets any subset of the recorded tests be replayed.
+func WithCassetteScope(ctx context.Context, scope string) context.Context {
+	return context.WithValue(ctx, cassetteScopeKey{}, scope)
+}
+
+// newCassetteRequest returns the matched properties of req, the body read through GetBody
+func newCassetteRequest(req *http.Request) (cassetteRequest, error) {
+	request := cassetteRequest{Method: req.Method, Path: req.URL.Path, Query: req.URL.Query().Encode()}
+	request.Scope, _ = req.Context().Value(cassetteScopeKey{}).(string)
+	if req.GetBody != nil && req.ContentLength != 0 {
+		body, err := req.GetBody()
+		if err != nil {
+			return request, err
+		}
+		data, err := ioutil.ReadAll(body)
+		_ = body.Close()
+		if err != nil {
+			return request, err
+		}
+		request.Body, request.BodyEncoding = harText(data)
+	}
+	return request, nil
+}
+
+// record appends exchange to the file
+func (cassette *Cassette) record(exchange *cassetteExchange) error {
+	line, err := json.Marshal(exchange)
+	if err != nil {
+		return err
+	}
+	cassette.mu.Lock()
+	defer cassette.mu.Unlock()
+	if cassette.file == nil {
+		return os.ErrClosed
+	}
+	_, err = cassette.file.Write(append(line, '\n'))
+	return err
+}
+
+// replay returns the response of the first matching exchange not replayed yet
+func (cassette *Cassette) replay(req *http.Request, request cassetteRequest) (*http.Response, error) {
+	cassette.mu.Lock()
+	defer cassette.mu.Unlock()
+	for i, exchange := range cassette.exchanges {
+		if cassette.replayed[i] || exchange.Request != request {
+			continue
+		}
+		body := []byte(exchange.Response.Body)
+		if exchange.Response.BodyEncoding == "base64" {
+			var err error
+			if body, err = base64.StdEncoding.DecodeString(exchange.Response.Body); err != nil {
+				return nil, fmt.Errorf("invalid body in the cassette for %s %s: %s", req.Method, req.URL.RequestURI(),
+					err)
+			}
+		}
+		cassette.replayed[i] = true
+		header := exchange.Response.Header.Clone()
+		if header == nil {
+			header = http.Header{}
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", exchange.Response.StatusCode, http.StatusText(exchange.Response.StatusCode)),
+			StatusCode:    exchange.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          ioutil.NopCloser(bytes.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("no recorded exchange in the cassette for %s %s", req.Method, req.URL.RequestURI())
+}
@@ -0,0 +1,217 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCassette_RecordReplay(t *testing.T) {
+	var version uint32
+	client, server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		if r.Method == http.MethodPatch {
+			atomic.AddUint32(&version, 1)
+		}
+		_, _ = fmt.Fprintf(w, `{"data":{"id":"1","version":%d}}`, atomic.LoadUint32(&version))
+	})
+	name := filepath.Join(t.TempDir(), "cassette.jsonl")
+
+	// Records a fetch, an update and a fetch of the updated account
+	recorder, err := NewCassette(name, CassetteRecord)
+	if err != nil {
+		t.Fatalf("NewCassette() failed: %s", err)
+	}
+	client.Use(recorder.Middleware)
+	update := &Account{Id: "1", OrganisationId: "org", Attributes: &AccountAttributes{Country: "GB"}}
+	exercise := func(client *ApiClient) []uint {
+		var versions []uint
+		for _, action := range []func() (*Account, *ApiError){
+			func() (*Account, *ApiError) { return client.FetchAccount(context.Background(), "1") },
+			func() (*Account, *ApiError) { return client.UpdateAccount(context.Background(), "1", update) },
+			func() (*Account, *ApiError) { return client.FetchAccount(context.Background(), "1") },
+		} {
+			account, apiErr := action()
+			if apiErr != nil {
+				t.Fatalf("Action failed: %s", apiErr)
+			}
+			versions = append(versions, account.Version)
+		}
+		return versions
+	}
+	recorded := exercise(client)
+	if err := recorder.Close(); err != nil {
+		t.Fatalf("Close() failed: %s", err)
+	}
+	server.Close()
+
+	// Replays offline, with another base URL
+	player, err := NewCassette(name, CassetteReplay)
+	if err != nil {
+		t.Fatalf("NewCassette() failed: %s", err)
+	}
+	client, err = NewApiClient(WithBaseURL("http://replay.invalid/"))
+	if err != nil {
+		t.Fatalf("NewApiClient() failed: %s", err)
+	}
+	client.Use(player.Middleware)
+	if replayed := exercise(client); fmt.Sprint(replayed) != fmt.Sprint(recorded) || fmt.Sprint(recorded) != "[0 1 1]" {
+		t.Errorf("Replayed versions %v differ from the recorded %v", replayed, recorded)
+	}
+
+	// Each exchange is replayed once
+	client.SetRetries(1)
+	if _, apiErr := client.FetchAccount(context.Background(), "1"); apiErr == nil ||
+		!strings.Contains(apiErr.Error(), "no recorded exchange") {
+		t.Errorf("Expected no recorded exchange, got %v", apiErr)
+	}
+}
+
+func TestCassette_MatchesBody(t *testing.T) {
+	client, server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		_, _ = w.Write([]byte(`{"data":{"id":"1","organisation_id":"org"}}`))
+	})
+	name := filepath.Join(t.TempDir(), "cassette.jsonl")
+	recorder, err := NewCassette(name, CassetteRecord)
+	if err != nil {
+		t.Fatalf("NewCassette() failed: %s", err)
+	}
+	client.Use(recorder.Middleware)
+	update := &Account{Id: "1", OrganisationId: "org", Attributes: &AccountAttributes{Country: "GB"}}
+	if _, apiErr := client.UpdateAccount(context.Background(), "1", update); apiErr != nil {
+		t.Fatalf("UpdateAccount() failed: %s", apiErr)
+	}
+	_ = recorder.Close()
+	server.Close()
+
+	player, err := NewCassette(name, CassetteReplay)
+	if err != nil {
+		t.Fatalf("NewCassette() failed: %s", err)
+	}
+	client, err = NewApiClient(WithBaseURL(server.URL + "/"))
+	if err != nil {
+		t.Fatalf("NewApiClient() failed: %s", err)
+	}
+	client.Use(player.Middleware)
+	client.SetRetries(1)
+	update.Attributes.Country = "HU"
+	if _, apiErr := client.UpdateAccount(context.Background(), "1", update); apiErr == nil {
+		t.Error("UpdateAccount() with another body was replayed")
+	}
+	update.Attributes.Country = "GB"
+	if _, apiErr := client.UpdateAccount(context.Background(), "1", update); apiErr != nil {
+		t.Errorf("UpdateAccount() was not replayed: %s", apiErr)
+	}
+}
+
+func TestParseCassetteMode(t *testing.T) {
+	for _, mode := range []CassetteMode{CassetteReplay, CassetteRecord} {
+		if parsed, err := ParseCassetteMode(mode.String()); err != nil || parsed != mode {
+			t.Errorf("ParseCassetteMode(%q) = %v, %v", mode.String(), parsed, err)
+		}
+	}
+	if _, err := ParseCassetteMode("rewind"); err == nil {
+		t.Error("ParseCassetteMode() accepted an unknown mode")
+	}
+}
+
+func TestCassette_BinaryBodies(t *testing.T) {
+	client, server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "gzip" {
+			t.Errorf("Request body is not compressed")
+		}
+		w.Header().Set("Content-Type", ContentType)
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		_, _ = gz.Write([]byte(`{"data":{"id":"1","version":1}}`))
+		_ = gz.Close()
+	})
+	client.SetGzipRequestThreshold(1)
+	name := filepath.Join(t.TempDir(), "cassette.jsonl")
+	recorder, err := NewCassette(name, CassetteRecord)
+	if err != nil {
+		t.Fatalf("NewCassette() failed: %s", err)
+	}
+	client.Use(recorder.Middleware)
+	update := &Account{Id: "1", OrganisationId: "org", Attributes: &AccountAttributes{Country: "GB"}}
+	if _, apiErr := client.UpdateAccount(context.Background(), "1", update); apiErr != nil {
+		t.Fatalf("UpdateAccount() failed: %s", apiErr)
+	}
+	_ = recorder.Close()
+	server.Close()
+
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"body_encoding":"base64"`) {
+		t.Errorf("Expected base64 encoded request body: %s", data)
+	}
+
+	player, err := NewCassette(name, CassetteReplay)
+	if err != nil {
+		t.Fatalf("NewCassette() failed: %s", err)
+	}
+	client, err = NewApiClient(WithBaseURL(server.URL + "/"))
+	if err != nil {
+		t.Fatalf("NewApiClient() failed: %s", err)
+	}
+	client.SetGzipRequestThreshold(1)
+	client.Use(player.Middleware)
+	account, apiErr := client.UpdateAccount(context.Background(), "1", update)
+	if apiErr != nil {
+		t.Fatalf("UpdateAccount() was not replayed: %s", apiErr)
+	}
+	if account.Version != 1 {
+		t.Errorf("Unexpected replayed account: %v", account)
+	}
+}
+
+func TestCassette_Scopes(t *testing.T) {
+	var requests int32
+	client, server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		_, _ = fmt.Fprintf(w, `{"data":{"id":"1","version":%d}}`, atomic.AddInt32(&requests, 1))
+	})
+	name := filepath.Join(t.TempDir(), "cassette.jsonl")
+	recorder, err := NewCassette(name, CassetteRecord)
+	if err != nil {
+		t.Fatalf("NewCassette() failed: %s", err)
+	}
+	client.Use(recorder.Middleware)
+	for _, scope := range []string{"first", "second"} {
+		if _, apiErr := client.FetchAccount(WithCassetteScope(context.Background(), scope), "1"); apiErr != nil {
+			t.Fatalf("FetchAccount() failed: %s", apiErr)
+		}
+	}
+	_ = recorder.Close()
+	server.Close()
+
+	player, err := NewCassette(name, CassetteReplay)
+	if err != nil {
+		t.Fatalf("NewCassette() failed: %s", err)
+	}
+	client, err = NewApiClient(WithBaseURL(server.URL + "/"))
+	if err != nil {
+		t.Fatalf("NewApiClient() failed: %s", err)
+	}
+	client.Use(player.Middleware)
+	client.SetRetries(1)
+	// The second scope is replayed on its own
+	account, apiErr := client.FetchAccount(WithCassetteScope(context.Background(), "second"), "1")
+	if apiErr != nil || account.Version != 2 {
+		t.Errorf("Unexpected replay of the second scope: %v, %v", account, apiErr)
+	}
+	if _, apiErr := client.FetchAccount(context.Background(), "1"); apiErr == nil {
+		t.Error("An exchange of a scope was replayed without scope")
+	}
+}
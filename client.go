@@ -5,15 +5,16 @@ package interview_accountapi
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"log"
+	"mime"
 	"net/http"
 	"net/url"
-	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -34,244 +35,652 @@ const (
 	DefaultPaginationSize = 100
 	// Delay between (the initiation of) requests when iterating through the pages of a paginated response (like List)
 	DefaultPaginationBackOff = time.Duration(400) * time.Millisecond
+	// Maximum size of a response body read by the client
+	DefaultMaxResponseSize = 10 << 20
 )
 
-// The Form3 API client
+// The Form3 API client, safe for concurrent use.
+//
+// The setters may be invoked while requests are in progress: each operation (like FetchAccount, or ListAccounts with
+// all of its pages) works with a snapshot of the configuration taken when it was started.
 type ApiClient struct {
-	// Retry HTTP requests N times if received an unexpected status code, min 1
-	Retries uint
-	// Wait between initiation of requests in a retry scenario
-	ErrorBackOff time.Duration
+	// Serialises the setters
+	mu sync.Mutex
+	// The current *clientConfig, replaced as a whole by the setters
+	config atomic.Value
+	// Concurrent FetchAccount calls in flight
+	fetches fetchGroup
+}
+
+// clientConfig is the configuration of ApiClient, immutable once stored (the setters store modified copies)
+type clientConfig struct {
+	// Retry HTTP requests N times if received an unexpected status code, min 1 (unless retryPolicy is set)
+	retries uint
+	// Wait between initiation of requests in a retry scenario (unless retryPolicy is set)
+	errorBackOff time.Duration
 	// Wait between initiation of requests when iterating over the pages of a paginated response (like List)
-	PaginationBackOff time.Duration
+	paginationBackOff time.Duration
 	// Base URL for API requests
 	baseURL *url.URL
 	// The underlying HTTP client
 	httpClient *http.Client
 	// Number of items per page for List actions (default 100, max 1000)
 	pageSize uint
+	// Decides about retrying failed requests, nil for FixedBackOff with retries and errorBackOff
+	retryPolicy RetryPolicy
+	// Throttles all requests passing through Do, or nil
+	rateLimiter RateLimiter
+	// Chain of middlewares wrapping each attempt in Do, outermost first
+	middlewares []Middleware
+	// Supplies bearer tokens for each request, or nil
+	tokenSource TokenSource
+	// OnRetry hooks invoked before retrying in Do
+	retryHooks []func(req *http.Request, attempt uint, delay time.Duration)
+	// Receives log messages, NopLogger by default
+	logger Logger
+	// Receives measurements, noMetrics by default
+	metrics MetricsCollector
+	// Starts spans of operations and attempts, noTracer by default
+	tracer Tracer
+	// Fails attempts fast while the API seems to be down, or nil
+	circuitBreaker *CircuitBreaker
+	// How CreateAccount guards against duplicates on retries
+	createMode CreateMode
+	// Whether JsonRequest encodes request data straight into the request stream
+	streamJson bool
+	// Maximum size of response bodies, 0 for no limit
+	maxResponseSize int64
+	// Whether to request gzip compressed responses
+	acceptGzip bool
+	// Size of request bodies from which they are gzip compressed, 0 if disabled
+	gzipThreshold int64
+	// User-Agent header of the requests, if not empty
+	userAgent string
+	// Sends hedged requests for idempotent reads, or nil
+	hedger *Hedger
+	// Read-through cache of FetchAccount, or nil
+	cache *AccountCache
+	// Overall budget of an operation spanning all the attempts, 0 if unlimited
+	budget time.Duration
+	// Endpoints to fail over between, or nil
+	endpoints *EndpointPool
 }
 
-// NewApiClient creates a new Form3 API client with defaults
-func NewApiClient() *ApiClient {
-	client := ApiClient{
-		Retries:           DefaultRetries,
-		ErrorBackOff:      DefaultErrorBackOff,
-		PaginationBackOff: DefaultPaginationBackOff,
+// NewApiClient creates a new Form3 API client with defaults, configured by opts (like WithBaseURL or WithTransport).
+// Returns an error if any of the options is invalid.
+func NewApiClient(opts ...Option) (*ApiClient, error) {
+	options := clientOptions{baseURL: ApiBase, timeout: DefaultTimeout}
+	for _, opt := range opts {
+		if err := opt(&options); err != nil {
+			return nil, fmt.Errorf("invalid option: %s", err)
+		}
+	}
+	transport, err := options.buildTransport()
+	if err != nil {
+		return nil, fmt.Errorf("invalid option: %s", err)
+	}
+
+	config := clientConfig{
+		retries:           DefaultRetries,
+		errorBackOff:      DefaultErrorBackOff,
+		paginationBackOff: DefaultPaginationBackOff,
 		pageSize:          DefaultPaginationSize,
+		maxResponseSize:   DefaultMaxResponseSize,
+		acceptGzip:        true,
+		logger:            NopLogger{},
+		metrics:           noMetrics{},
+		tracer:            noTracer{},
+		userAgent:         options.userAgent,
 	}
 
-	client.httpClient = &http.Client{Timeout: DefaultTimeout}
+	config.httpClient = &http.Client{Timeout: options.timeout, Transport: transport}
 
-	e := client.SetBaseURL(ApiBase)
-	if e != nil {
-		log.Panicf("Failed parsing base URL constant: %s: %s", e, ApiBase)
+	if config.baseURL, err = url.Parse(options.baseURL); err != nil {
+		return nil, fmt.Errorf("failed parsing base URL: %s: %s", err, options.baseURL)
+	}
+	if options.baseURLs != nil {
+		settings := EndpointSettings{HTTPClient: config.httpClient}
+		if config.endpoints, err = NewEndpointPool(options.baseURLs, settings); err != nil {
+			return nil, fmt.Errorf("invalid option: %s", err)
+		}
+		config.baseURL = config.endpoints.endpoints[0].base
 	}
 
-	return &client
+	client := &ApiClient{}
+	client.config.Store(&config)
+	return client, nil
+}
+
+// snapshot returns the current configuration, not to be modified
+func (client *ApiClient) snapshot() *clientConfig {
+	return client.config.Load().(*clientConfig)
+}
+
+// update stores a copy of the configuration modified by apply, slices shall be copied before being modified
+func (client *ApiClient) update(apply func(config *clientConfig)) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	config := *client.snapshot()
+	apply(&config)
+	client.config.Store(&config)
+}
+
+// Gets the number of attempts of failed HTTP requests (unless a RetryPolicy is set)
+func (client *ApiClient) Retries() uint {
+	return client.snapshot().retries
+}
+
+// Sets the number of attempts of failed HTTP requests, min 1 (unless a RetryPolicy is set)
+func (client *ApiClient) SetRetries(retries uint) {
+	client.update(func(config *clientConfig) { config.retries = retries })
+}
+
+// Gets the wait between initiation of requests in a retry scenario (unless a RetryPolicy is set)
+func (client *ApiClient) ErrorBackOff() time.Duration {
+	return client.snapshot().errorBackOff
+}
+
+// Sets the wait between initiation of requests in a retry scenario (unless a RetryPolicy is set)
+func (client *ApiClient) SetErrorBackOff(backOff time.Duration) {
+	client.update(func(config *clientConfig) { config.errorBackOff = backOff })
+}
+
+// Gets the wait between initiation of requests when iterating over the pages of a paginated response (like List)
+func (client *ApiClient) PaginationBackOff() time.Duration {
+	return client.snapshot().paginationBackOff
+}
+
+// Sets the wait between initiation of requests when iterating over the pages of a paginated response (like List)
+func (client *ApiClient) SetPaginationBackOff(backOff time.Duration) {
+	client.update(func(config *clientConfig) { config.paginationBackOff = backOff })
 }
 
 // Gets client.pageSize
 func (client *ApiClient) PageSize() int {
-	return int(client.pageSize)
+	return int(client.snapshot().pageSize)
 }
 
 // Sets number of results requested per pagination page
 func (client *ApiClient) SetPageSize(pageSize int) {
 	if pageSize < 1 {
-		client.pageSize = 1
+		pageSize = 1
 	} else if pageSize > 1000 {
-		client.pageSize = 1000
-	} else {
-		client.pageSize = uint(pageSize)
+		pageSize = 1000
 	}
+	client.update(func(config *clientConfig) { config.pageSize = uint(pageSize) })
+}
+
+// Gets the RetryPolicy of the client, nil if using Retries and ErrorBackOff
+func (client *ApiClient) RetryPolicy() RetryPolicy {
+	return client.snapshot().retryPolicy
+}
+
+// Sets a RetryPolicy to decide about retrying failed requests, nil restores FixedBackOff with Retries and ErrorBackOff
+func (client *ApiClient) SetRetryPolicy(policy RetryPolicy) {
+	client.update(func(config *clientConfig) { config.retryPolicy = policy })
+}
+
+// Gets the RateLimiter of the client, or nil
+func (client *ApiClient) RateLimiter() RateLimiter {
+	return client.snapshot().rateLimiter
+}
+
+// Sets a RateLimiter for all requests passing through Do (including pages of ListAccounts), nil disables it
+func (client *ApiClient) SetRateLimiter(limiter RateLimiter) {
+	client.update(func(config *clientConfig) { config.rateLimiter = limiter })
 }
 
 // Gets current API root URL as string
 func (client *ApiClient) BaseURL() string {
-	return client.baseURL.String()
+	return client.snapshot().baseURL.String()
 }
 
-// SetBaseURL sets/changes the API root URL by parsing an URL string
+// SetBaseURL sets/changes the API root URL by parsing an URL string, it's left unchanged on error
 func (client *ApiClient) SetBaseURL(apiBase string) error {
-	var err error
-	client.baseURL, err = url.Parse(apiBase)
-	return err // returns error or nil if success
+	baseURL, err := url.Parse(apiBase)
+	if err != nil {
+		return err
+	}
+	client.update(func(config *clientConfig) { config.baseURL = baseURL })
+	return nil
 }
 
 // Gets overall request timeout (time.Duration)
 func (client *ApiClient) Timeout() time.Duration {
-	return client.httpClient.Timeout
+	return client.snapshot().httpClient.Timeout
 }
 
 // Sets overall request timeout (time.Duration)
 func (client *ApiClient) SetTimeout(duration time.Duration) {
-	client.httpClient.Timeout = duration
+	client.update(func(config *clientConfig) {
+		// Requests in progress keep using the previous http.Client, sharing the transport
+		httpClient := *config.httpClient
+		httpClient.Timeout = duration
+		config.httpClient = &httpClient
+	})
 }
 
-// NewRequest creates a new HTTP request of method with path relative to the baseURL of the client,
+// NewRequest creates a new HTTP request bound to ctx of method with path relative to the baseURL of the client,
 // and an optional body of io.Reader or nil
-func (client *ApiClient) NewRequest(method string, path string, body io.Reader) (*http.Request, error) {
+func (client *ApiClient) NewRequest(ctx context.Context, method string, path string, body io.Reader) (
+	*http.Request, error) {
+	return client.snapshot().newRequest(ctx, method, path, body)
+}
+
+// newRequest implements NewRequest
+func (config *clientConfig) newRequest(ctx context.Context, method string, path string, body io.Reader) (
+	*http.Request, error) {
 	u, err := url.Parse(path)
 	if err != nil {
-		log.Print("Failed parsing path,", err, path)
+		config.logger.Log(ctx, LogLevelError, "Failed parsing path", "path", path, "error", err)
 		return nil, err
 	}
-	u = client.baseURL.ResolveReference(u)
+	u = config.baseURL.ResolveReference(u)
 
-	req, err := http.NewRequest(method, u.String(), body)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
 	if err != nil {
-		log.Print("Failed creating", method, "request,", err, path)
+		config.logger.Log(ctx, LogLevelError, "Failed creating request", "method", method, "path", path, "error", err)
 		return nil, err
 	}
 
 	req.Header.Set("Accept", Accept)
+	if config.userAgent != "" {
+		req.Header.Set("User-Agent", config.userAgent)
+	}
 	if body != nil {
 		req.Header.Set("Content-Type", ContentType)
 	}
+	injectTrace(ctx, req)
 
 	return req, nil
 }
 
-// Do executes the http.Request with timeout and Retries
+// Do executes the http.Request with timeout and Retries, bound to ctx
+//
+// Cancellation or deadline of ctx aborts the pending HTTP request as well as the ErrorBackOff delay between retries,
+// then the context error is returned.
 //
-// A response status code of >= 200 < 300 is considered successful.
+// Every attempt waits for the RateLimiter of the client (if any), which also observes every response.
+// While the CircuitBreaker of the client (if any) is open, fails fast with ErrorCode ErrorCodeCircuitOpen.
+// GET requests are hedged by the Hedger of the client (if any), as a single attempt.
+// Each attempt is executed through the Middleware chain of the client (see Use and AddHooks).
 //
-// Status codes <200 400 401 403 404 405 406 407 409 410 414 418 431 are considered unrecoverable and not retried.
-// Timeout is calculated from the initiation of the request.
-// There is an ErrorBackOff delay between they initiation of Retries. When retries are exhausted,
-// the error of the last request is returned.
+// A response status code of >= 200 < 300 is considered successful, as well as 304 Not Modified to a conditional
+// request (with an If-None-Match or If-Modified-Since header).
+//
+// Failed attempts are retried as decided by the RetryPolicy of the client. Without one, the default policy is
+// FixedBackOff built from Retries and ErrorBackOff, where status codes <200 400 401 403 404 405 406 407 409 410 414
+// 418 431 are considered unrecoverable and not retried, and there is an ErrorBackOff delay between the initiation of
+// Retries. Timeout is calculated from the initiation of the request. When retries are exhausted,
+// the error of the last request is returned. The overall Budget (if any) limits the attempts and the delays between
+// them, failing with ErrorCode ErrorCodeBudgetExhausted when it runs out (see SetBudget).
 //
 // Retrying introduces a trade-off with POST (Create) requests as it may result in a Conflict on succeeding tries if
-// the success from the first try got hidden. This shall be handled by the caller. (see CreateAccount for example)
+// the success from the first try got hidden. This shall be handled by the caller, for example with an Idempotency-Key
+// header, which is kept across the retries. (see CreateAccount)
+//
+// Responses are requested gzip compressed and decoded (see SetAcceptGzip), large request bodies may be compressed
+// (see SetGzipRequestThreshold).
+//
+// The request body is not buffered, it's replayed for retries through req.GetBody (set by http.NewRequest for
+// in-memory readers), or by seeking back if the body is an io.Seeker (which is then closed by Do). Requests with other
+// bodies are not retried, failing with ErrorCode ErrorCodeBodyNotReplayable when a retry would have been due.
 //
 // Returned ApiError has Error interface with StatusCode property with the returned HTTP status code.
 // If an error message is present in the response, it is parsed
-func (client *ApiClient) Do(req *http.Request) (*http.Response, *ApiError) {
-	var body []byte
+func (client *ApiClient) Do(ctx context.Context, req *http.Request) (*http.Response, *ApiError) {
+	return client.snapshot().do(ctx, req)
+}
+
+// do implements Do
+func (config *clientConfig) do(ctx context.Context, req *http.Request) (*http.Response, *ApiError) {
 	var err error
 	var resp *http.Response
 
-	if req.Body != nil {
-		// Reuse request body between retries
-		// attribution: https://stackoverflow.com/a/54706278
-		if body, err = ioutil.ReadAll(req.Body); err != nil {
-			log.Panic("failed sucking up request body")
+	// The budget ends when the response body is closed, or on failure
+	parent := ctx
+	ctx, budgetDeadline, cancelBudget := config.budgetContext(ctx)
+	var budgetOut, keepBudget bool
+	defer func() {
+		if !keepBudget {
+			cancelBudget()
 		}
-		if err = req.Body.Close(); err != nil {
-			log.Panic("failed closing request body")
+	}()
+
+	req = req.WithContext(ctx)
+
+	if err = config.gzipRequest(req); err != nil {
+		apiErr := NewApiError(nil, "Failed compressing request body: %s", err)
+		apiErr.Err = err
+		return nil, apiErr
+	}
+
+	// Replays the request body between retries, without buffering it
+	body, err := newRequestBody(req)
+	if err != nil {
+		apiErr := NewApiError(nil, "Failed preparing request body: %s", err)
+		apiErr.Err = err
+		return nil, apiErr
+	}
+	defer func() {
+		if e := body.close(); e != nil {
+			config.logger.Log(ctx, LogLevelWarn, "Closing of request body failed", "error", e)
 		}
+	}()
+	var notReplayable bool
+
+	rt := config.roundTripper()
+	pathTemplate := config.pathTemplate(req)
+	policy := config.retryPolicy
+	if policy == nil {
+		policy = &FixedBackOff{Attempts: config.retries, BackOff: config.errorBackOff}
 	}
 
-	var lastTime time.Time
+	var attempts uint
 Retry:
-	for turn := uint(0); turn < client.Retries; turn++ {
-		if req.Body != nil {
-			// Recreating request body for each requests
-			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	for attempt := uint(1); ; attempt++ {
+		attempts = attempt
+		attemptCtx := withAttempt(ctx, attempt)
+
+		// Fails over between the endpoints, if the request is for one of them
+		attemptURL := req.URL
+		var attemptEndpoint *endpoint
+		if config.endpoints != nil && config.endpoints.endpointOf(req.URL.String()) != nil {
+			attemptEndpoint = config.endpoints.pick()
+			attemptURL = config.endpoints.rebase(req.URL, attemptEndpoint)
+			attemptCtx = withEndpoint(attemptCtx, attemptEndpoint.prefix)
 		}
 
-		if turn > 0 {
-			sleepDuration := client.ErrorBackOff - time.Now().Sub(lastTime)
-			if sleepDuration > 0 {
-				log.Printf("Retrying %s request in %v %s %s",
-					req.Proto, sleepDuration, req.Method, req.URL.String())
-				time.Sleep(sleepDuration)
+		// Middlewares may alter the request, each attempt starts from a copy of the original
+		attemptCtx, span := config.tracer.Start(attemptCtx, "HTTP "+req.Method)
+		span.SetAttribute("http.method", req.Method)
+		span.SetAttribute("http.url", attemptURL.String())
+		span.SetAttribute("attempt", attempt)
+		if attemptEndpoint != nil {
+			span.SetAttribute("endpoint", attemptEndpoint.prefix)
+		}
+		attemptReq := req.Clone(attemptCtx)
+		attemptReq.URL, attemptReq.Host = attemptURL, attemptURL.Host
+		injectTrace(attemptCtx, attemptReq)
+		// The breaker is checked first, so that an open circuit fails fast without waiting for the rate limiter
+		var breakerDone func(failure bool)
+		var breakerRelease func()
+		if config.circuitBreaker != nil {
+			var allowed bool
+			if breakerDone, breakerRelease, allowed = config.circuitBreaker.allow(); !allowed {
+				err = errCircuitOpen
+				span.End(err)
+				resp = nil
+				break Retry
 			}
 		}
 
-		// Executes the actual HTTP request here
-		log.Printf("%s request %s %s", req.Proto, req.Method, req.URL.String())
-		lastTime = time.Now()
-		resp, err = client.httpClient.Do(req)
+		if config.rateLimiter != nil {
+			if err = config.rateLimiter.Wait(ctx); err != nil {
+				if breakerRelease != nil {
+					breakerRelease()
+				}
+				span.End(err)
+				resp = nil
+				break Retry
+			}
+		}
 
-		if err != nil {
-			log.Printf("%s request failed: %s", req.Proto, err)
-			continue Retry
+		// The body is produced once the attempt is admitted, as nothing would close it otherwise (like a JSON stream)
+		if body != nil {
+			if attemptReq.Body, err = body.forAttempt(attempt); err != nil {
+				if breakerRelease != nil {
+					breakerRelease()
+				}
+				err = &requestBodyError{err}
+				span.End(err)
+				resp = nil
+				break Retry
+			}
 		}
 
-		if resp == nil {
-			log.Panic("http.client.Do() returned nil request and nil error")
+		// Executes the actual HTTP request here
+		config.logger.Log(ctx, LogLevelDebug, "Request",
+			"method", req.Method, "url", attemptURL.String(), "attempt", attempt)
+		lastTime := time.Now()
+		config.metrics.InFlight(1)
+		if config.hedger != nil && body == nil &&
+			(attemptReq.Method == http.MethodGet || attemptReq.Method == http.MethodHead) {
+			var hedged bool
+			resp, hedged, err = config.hedger.roundTrip(rt, attemptReq, config.admitHedge)
+			span.SetAttribute("hedged", hedged)
+		} else {
+			resp, err = rt.RoundTrip(attemptReq)
+		}
+		config.metrics.InFlight(-1)
+		config.metrics.ObserveRequest(req.Method, pathTemplate, statusCode(resp), time.Now().Sub(lastTime))
+		if breakerDone != nil {
+			if err != nil && ctx.Err() != nil {
+				// Cancelled by the caller (or ran out of budget), not an outcome of the API
+				breakerRelease()
+			} else {
+				breakerDone(err != nil || statusCode(resp) >= 500)
+			}
+		}
+		if attemptEndpoint != nil && (err != nil && ctx.Err() == nil || statusCode(resp) >= 500) {
+			config.logger.Log(ctx, LogLevelWarn, "Endpoint marked unhealthy", "endpoint", attemptEndpoint.prefix)
+			config.endpoints.markUnhealthy(attemptEndpoint)
+		}
+		if resp != nil {
+			span.SetAttribute("http.status_code", resp.StatusCode)
+		}
+		if err != nil {
+			span.End(err)
+		} else if resp != nil && !successful(req, resp) {
+			span.End(errors.New(resp.Status))
+		} else {
+			span.End(nil)
+		}
+		if config.rateLimiter != nil {
+			config.rateLimiter.Observe(resp)
 		}
 
-		log.Printf("%s response %s %v (%d bytes) from %s %s",
-			resp.Proto, resp.Status, time.Now().Sub(lastTime), resp.ContentLength,
-			req.Method, req.URL.String())
+		if err != nil {
+			config.logger.Log(ctx, LogLevelWarn, "Request failed",
+				"method", req.Method, "url", req.URL.String(), "attempt", attempt,
+				"latency", time.Now().Sub(lastTime), "error", err)
+			if ctx.Err() != nil {
+				// Cancelled or deadline exceeded, no point in retrying
+				err = ctx.Err()
+				break Retry
+			}
+			var bodyErr *requestBodyError
+			if errors.As(err, &bodyErr) {
+				// Producing the body failed, it would fail again
+				err = bodyErr
+				break Retry
+			}
+		} else {
+			if resp == nil {
+				err = errors.New("RoundTrip() returned nil response and nil error")
+				break Retry
+			}
 
-		if 0 < resp.StatusCode && resp.StatusCode < 300 {
-			// success (perhaps should be more strict <= 200)
-			break Retry
+			config.logger.Log(ctx, LogLevelDebug, "Response",
+				"method", req.Method, "url", req.URL.String(), "attempt", attempt,
+				"status", resp.StatusCode, "latency", time.Now().Sub(lastTime), "length", resp.ContentLength)
+
+			if successful(req, resp) {
+				// success (perhaps should be more strict <= 200)
+				break Retry
+			}
 		}
 
-		// Some errors shan't be repeated
-		switch resp.StatusCode {
-		case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound,
-			http.StatusMethodNotAllowed, http.StatusNotAcceptable, http.StatusProxyAuthRequired,
-			http.StatusConflict, http.StatusGone, http.StatusRequestURITooLong, http.StatusTeapot,
-			http.StatusRequestHeaderFieldsTooLarge:
+		// The policy decides whether to retry and how long to wait
+		elapsed := time.Now().Sub(lastTime)
+		retry, sleepDuration := policy.Retry(&RetryAttempt{
+			Method:     req.Method,
+			StatusCode: statusCode(resp),
+			Response:   resp,
+			Err:        err,
+			Attempt:    attempt,
+			Elapsed:    elapsed,
+		})
+		if !retry {
+			break Retry
+		}
+		if !body.replayable() {
+			config.logger.Log(ctx, LogLevelWarn, "Request body can not be replayed, not retrying",
+				"method", req.Method, "url", req.URL.String(), "attempt", attempt)
+			notReplayable = true
+			break Retry
+		}
+		if config.budget > 0 && time.Until(budgetDeadline) < sleepDuration+config.attemptEstimate(elapsed) {
+			config.logger.Log(ctx, LogLevelWarn, "Budget would run out before the retry finishes, not retrying",
+				"method", req.Method, "url", req.URL.String(), "attempt", attempt)
+			budgetOut = true
 			break Retry
 		}
 
-		if e := resp.Body.Close(); e != nil {
-			log.Print("Closing of response body failed!")
+		if resp != nil {
+			if e := resp.Body.Close(); e != nil {
+				config.logger.Log(ctx, LogLevelWarn, "Closing of response body failed", "error", e)
+			}
+		}
+
+		config.metrics.ObserveRetry(req.Method, pathTemplate)
+		for _, hook := range config.retryHooks {
+			hook(req, attempt+1, sleepDuration)
+		}
+
+		config.logger.Log(ctx, LogLevelInfo, "Retrying request",
+			"method", req.Method, "url", req.URL.String(), "attempt", attempt+1,
+			"status", statusCode(resp), "delay", sleepDuration)
+		if sleepDuration > 0 {
+			if e := sleepContext(ctx, sleepDuration); e != nil {
+				resp, err = nil, e
+				break Retry
+			}
 		}
 	}
 
+	if resp != nil && config.maxResponseSize > 0 {
+		resp.Body = &limitedBody{ReadCloser: resp.Body, limit: config.maxResponseSize, remaining: config.maxResponseSize}
+	}
+
 	var apiErr *ApiError
-	if err != nil {
-		apiErr = NewApiError(resp, err.Error())
-	} else if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+	if config.budget > 0 && (budgetOut || err != nil && budgetExhausted(parent, ctx)) {
+		config.logger.Log(ctx, LogLevelWarn, "Budget exhausted",
+			"method", req.Method, "url", req.URL.String(), "attempts", attempts)
+		apiErr = newBudgetError(resp, err, config.budget, attempts)
+	} else if err == errCircuitOpen {
+		config.logger.Log(ctx, LogLevelWarn, "Circuit breaker is open", "method", req.Method, "url", req.URL.String())
+		apiErr = wrapError(nil, err)
+		apiErr.ErrorCode = ErrorCodeCircuitOpen
+	} else if err != nil {
+		apiErr = wrapError(resp, err)
+	} else if !successful(req, resp) {
 		apiErr = NewApiError(resp, "Received unexpected HTTP status code %s", resp.Status)
 	}
+	if notReplayable && apiErr.ErrorCode == "" {
+		apiErr.ErrorCode = ErrorCodeBodyNotReplayable
+	}
+	if apiErr == nil && config.budget > 0 {
+		resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancelBudget}
+		keepBudget = true
+	}
 	return resp, apiErr
 }
 
-// JsonRequest creates and executes an HTTP request of method with relative path to the baseURL and an optional data
-// (or nil) in the request body (serializes it as JSON). Returns the HTTP response, the JSON decoder, and APIError.
-func (client *ApiClient) JsonRequest(method string, path string, data interface{}) (
+// JsonRequest creates and executes an HTTP request bound to ctx of method with relative path to the baseURL and an
+// optional data (or nil) in the request body (serializes it as JSON). Returns the HTTP response, the JSON decoder,
+// and APIError.
+func (client *ApiClient) JsonRequest(ctx context.Context, method string, path string, data interface{}) (
 	*http.Response, *json.Decoder, *ApiError) {
+	return client.snapshot().jsonRequest(ctx, method, path, data, nil)
+}
+
+// jsonRequest is JsonRequest with additional headers for the request (or nil).
+// A 304 Not Modified response to a conditional request is returned without a decoder.
+func (config *clientConfig) jsonRequest(ctx context.Context, method string, path string, data interface{},
+	header http.Header) (*http.Response, *json.Decoder, *ApiError) {
 	var (
-		body *bytes.Reader
-		err  error
-		req  *http.Request
+		err error
+		req *http.Request
 	)
 
 	if data == nil {
-		req, err = client.NewRequest(method, path, nil)
+		req, err = config.newRequest(ctx, method, path, nil)
+
+	} else if config.streamJson {
+		// Encode JSON data straight into the request stream, again for each retry
+		stream := jsonStream(data)
+		if req, err = config.newRequest(ctx, method, path, stream); err != nil {
+			_ = stream.Close()
+		} else {
+			req.GetBody = func() (io.ReadCloser, error) {
+				return jsonStream(data), nil
+			}
+		}
 
 	} else {
 		// Encode JSON data and present as io.Reader
-		jsonData, err := json.Marshal(data)
-		if err != nil {
-			return nil, nil, NewApiError(nil, err.Error())
+		var jsonData []byte
+		if jsonData, err = json.Marshal(data); err != nil {
+			return nil, nil, wrapError(nil, err)
 		}
-		body = bytes.NewReader(jsonData)
-
-		req, err = client.NewRequest(method, path, body)
+		req, err = config.newRequest(ctx, method, path, bytes.NewReader(jsonData))
 	}
 	if err != nil {
-		return nil, nil, NewApiError(nil, err.Error())
+		return nil, nil, wrapError(nil, err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
 	}
 
-	resp, apiErr := client.Do(req)
+	resp, apiErr := config.do(ctx, req)
 	if apiErr != nil {
 		return resp, nil, apiErr
 	}
+	if resp.StatusCode == http.StatusNotModified {
+		return resp, nil, nil
+	}
 
 	dec, err := decodeJsonResponse(resp)
 	if err != nil {
-		return resp, nil, NewApiError(nil, err.Error())
+		if e := resp.Body.Close(); e != nil {
+			config.logger.Log(ctx, LogLevelWarn, "Closing of response body failed", "error", e)
+		}
+		apiErr = wrapError(nil, err)
+		apiErr.StatusCode = resp.StatusCode
+		apiErr.ErrorCode = ErrorCodeContentType
+		return resp, nil, apiErr
 	}
 	return resp, dec, nil
 }
 
-// decodeJsonResponse returns a JSON decoder if response had the expected Content-Type header.
+// Media types of JSON response bodies
+var jsonMediaTypes = map[string]bool{
+	ContentType:        true,
+	"application/json": true,
+}
+
+// decodeJsonResponse returns a JSON decoder if response had a JSON media type in the Content-Type header
+// (application/vnd.api+json or application/json, with any parameters), otherwise a *ContentTypeError.
 func decodeJsonResponse(resp *http.Response) (*json.Decoder, error) {
-	ctype := resp.Header["Content-Type"]
-	if len(ctype) < 1 || strings.ToLower(ctype[0]) == ContentType {
-		err := errors.New(fmt.Sprint("Received unknown Content-Type:", ctype))
-		log.Print(err)
-		return nil, err
+	ctype := resp.Header.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(ctype)
+	if err != nil || !jsonMediaTypes[mediaType] {
+		return nil, &ContentTypeError{ContentType: ctype}
 	}
 	return json.NewDecoder(resp.Body), nil
 }
+
+// Gets the maximum size of response bodies, 0 for no limit
+func (client *ApiClient) MaxResponseSize() int64 {
+	return client.snapshot().maxResponseSize
+}
+
+// Sets the maximum size of response bodies (DefaultMaxResponseSize by default), reading beyond it fails with
+// *ResponseTooLargeError (see ErrorCodeResponseTooLarge). 0 or less disables the limit.
+func (client *ApiClient) SetMaxResponseSize(size int64) {
+	if size < 0 {
+		size = 0
+	}
+	client.update(func(config *clientConfig) { config.maxResponseSize = size })
+}
@@ -0,0 +1,140 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestServer starts an httptest.Server with handler and returns an ApiClient pointed at it.
+//
+// The server is closed by the cleanup of t.
+func newTestServer(t *testing.T, handler http.HandlerFunc) (*ApiClient, *httptest.Server) {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client, err := NewApiClient()
+	if err != nil {
+		t.Fatalf("Failed to create ApiClient: %s", err)
+	}
+	if err := client.SetBaseURL(server.URL + "/"); err != nil {
+		t.Fatalf("Failed to set API base URL: %s", err)
+	}
+	return client, server
+}
+
+func TestDo_ContextCancelsBackOff(t *testing.T) {
+	var requests int32
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	client.SetRetries(3)
+	client.SetErrorBackOff(time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, _, apiErr := client.JsonRequest(ctx, http.MethodGet, AccountsPath, nil)
+	if apiErr == nil {
+		t.Fatal("JsonRequest() returned no error for a cancelled context")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("ErrorBackOff was not interrupted by the context, took %v", elapsed)
+	}
+	if requests := atomic.LoadInt32(&requests); requests != 1 {
+		t.Errorf("Expected 1 request before cancellation, received %d", requests)
+	}
+}
+
+func TestListAccounts_ContextCancelled(t *testing.T) {
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentType+"; charset=utf-8")
+		_, _ = w.Write([]byte(`{"data":[{"id":"1"}],"links":{"next":"/` + AccountsPath + `?page[number]=1"}}`))
+	})
+	client.SetPaginationBackOff(time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	results := client.ListAccounts(ctx, nil)
+
+	if acc := <-results.Channel; acc == nil || acc.Id != "1" {
+		t.Fatalf("Unexpected first result: %v", acc)
+	}
+	cancel()
+
+	select {
+	case _, open := <-results.Channel:
+		if open {
+			t.Error("Received result after cancellation")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("PaginationBackOff was not interrupted by the context")
+	}
+	if results.Error == nil {
+		t.Error("Expected context error after cancellation")
+	}
+}
+
+func TestDecodeJsonResponse(t *testing.T) {
+	for ctype, valid := range map[string]bool{
+		ContentType:                             true,
+		ContentType + "; charset=utf-8":         true,
+		"application/json":                      true,
+		"Application/JSON; charset=UTF-8":       true,
+		"":                                      false,
+		"text/html; charset=utf-8":              false,
+		"application/vnd.api+json; charset=\"u": false,
+	} {
+		resp := &http.Response{Header: http.Header{}, Body: http.NoBody}
+		if ctype != "" {
+			resp.Header.Set("Content-Type", ctype)
+		}
+		_, err := decodeJsonResponse(resp)
+		if valid && err != nil {
+			t.Errorf("Content-Type %q was refused: %s", ctype, err)
+		} else if !valid {
+			var ctypeErr *ContentTypeError
+			if !errors.As(err, &ctypeErr) || ctypeErr.ContentType != ctype {
+				t.Errorf("Expected ContentTypeError for Content-Type %q, received %v", ctype, err)
+			}
+		}
+	}
+}
+
+func TestJsonRequest_UnexpectedContentType(t *testing.T) {
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<html>Bad Gateway</html>"))
+	})
+
+	_, apiErr := client.FetchAccount(context.Background(), "1")
+	if apiErr == nil || apiErr.ErrorCode != ErrorCodeContentType || apiErr.StatusCode != http.StatusOK {
+		t.Errorf("Expected an unexpected Content-Type error, received %#v", apiErr)
+	}
+}
+
+func TestJsonRequest_ResponseTooLarge(t *testing.T) {
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		_, _ = w.Write([]byte(`{"data":{"id":"1","type":"` + strings.Repeat("x", 1000) + `"}}`))
+	})
+	client.SetMaxResponseSize(100)
+
+	_, apiErr := client.FetchAccount(context.Background(), "1")
+	if apiErr == nil || apiErr.ErrorCode != ErrorCodeResponseTooLarge {
+		t.Errorf("Expected a response too large error, received %#v", apiErr)
+	}
+
+	client.SetMaxResponseSize(0)
+	if _, apiErr := client.FetchAccount(context.Background(), "1"); apiErr != nil {
+		t.Errorf("FetchAccount() failed without limit: %s", apiErr)
+	}
+}
@@ -0,0 +1,180 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Meant to be run with the race detector: go test -race -run Concurrent
+
+// newConcurrencyTestServer serves accounts: GET of account 1 (others are not found), 3 pages of listed accounts, POST,
+// PATCH and DELETE
+func newConcurrencyTestServer(t *testing.T) (*ApiClient, string) {
+	var serverURL string
+	client, server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		switch {
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		case r.URL.Path == "/"+AccountsPath && r.Method == http.MethodGet:
+			page, _ := strconv.Atoi(r.URL.Query().Get("page[number]"))
+			next := ""
+			if page < 2 {
+				next = fmt.Sprintf(`,"links":{"next":"%s/%s?page[number]=%d&page[size]=%s"}`,
+					serverURL, AccountsPath, page+1, r.URL.Query().Get("page[size]"))
+			}
+			_, _ = fmt.Fprintf(w, `{"data":[{"id":"%d"}]%s}`, page, next)
+		case r.Method == http.MethodPost:
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"data":{"id":"1"}}`))
+		case r.Method == http.MethodGet && r.URL.Path != "/"+AccountsPath+"/1":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			_, _ = w.Write([]byte(`{"data":{"id":"1"}}`))
+		}
+	})
+	serverURL = server.URL
+	return client, server.URL
+}
+
+func TestConcurrent_OperationsWhileReconfiguring(t *testing.T) {
+	client, serverURL := newConcurrencyTestServer(t)
+	client.SetPaginationBackOff(0)
+	client.SetErrorBackOff(0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var failures int32
+	operations := []func(){
+		func() {
+			if _, apiErr := client.FetchAccount(ctx, "1"); apiErr != nil {
+				atomic.AddInt32(&failures, 1)
+			}
+		},
+		func() {
+			account := &Account{Id: uuid4s(rand.Uint64), OrganisationId: uuid4s(rand.Uint64), Attributes: &AccountAttributes{Country: "GB"}}
+			if _, apiErr := client.CreateAccount(ctx, account); apiErr != nil {
+				atomic.AddInt32(&failures, 1)
+			}
+		},
+		func() {
+			account := &Account{Id: "1", OrganisationId: uuid4s(rand.Uint64), Attributes: &AccountAttributes{Country: "GB"}}
+			if _, apiErr := client.UpdateAccount(ctx, "1", account); apiErr != nil {
+				atomic.AddInt32(&failures, 1)
+			}
+		},
+		func() {
+			if apiErr := client.DeleteAccount(ctx, "1", 0); apiErr != nil {
+				atomic.AddInt32(&failures, 1)
+			}
+		},
+		func() {
+			results := client.ListAccounts(ctx, nil)
+			for range results.Channel {
+			}
+			if results.Error != nil {
+				atomic.AddInt32(&failures, 1)
+			}
+		},
+	}
+	for i := 0; i < 8; i++ {
+		for _, operation := range operations {
+			wg.Add(1)
+			go func(operation func()) {
+				defer wg.Done()
+				for j := 0; j < 5; j++ {
+					operation()
+				}
+			}(operation)
+		}
+	}
+
+	reconfigured := make(chan struct{})
+	go func() {
+		defer close(reconfigured)
+		for i := 0; i < 50; i++ {
+			client.SetRetries(uint(1 + i%3))
+			client.SetErrorBackOff(time.Duration(i%2) * time.Millisecond)
+			client.SetPaginationBackOff(time.Duration(i%2) * time.Millisecond)
+			client.SetPageSize(1 + i%5)
+			client.SetTimeout(time.Duration(5+i) * time.Second)
+			_ = client.SetBaseURL(serverURL + "/")
+			client.SetRetryPolicy(&FixedBackOff{Attempts: 2})
+			client.SetRateLimiter(NewTokenBucket(1000, 100))
+			client.SetCircuitBreaker(NewCircuitBreaker(CircuitBreakerSettings{}))
+			client.SetLogger(NopLogger{})
+			client.SetMetrics(NewMetrics())
+			client.SetTracer(&SimpleTracer{})
+			client.SetCreateMode(CreateMode(i % 2))
+			client.SetStreamJson(i%2 == 0)
+			client.SetAcceptGzip(i%3 != 0)
+			client.SetMaxResponseSize(DefaultMaxResponseSize)
+			client.SetAccountCache(NewAccountCache(CacheSettings{}))
+			client.SetBudget(time.Duration(i%2) * time.Minute)
+			client.Use(func(next http.RoundTripper) http.RoundTripper { return next })
+			client.AddHooks(Hooks{OnRetry: func(*http.Request, uint, time.Duration) {}})
+			_ = client.PageSize()
+			_ = client.BaseURL()
+			_ = client.Timeout()
+		}
+	}()
+
+	wg.Wait()
+	<-reconfigured
+	if failures := atomic.LoadInt32(&failures); failures > 0 {
+		t.Errorf("%d operations failed", failures)
+	}
+}
+
+func TestConcurrent_ListAccountsKeepsSnapshot(t *testing.T) {
+	var mu sync.Mutex
+	var pageSizes []string
+	client, _ := newConcurrencyTestServer(t)
+	client.Use(func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			mu.Lock()
+			pageSizes = append(pageSizes, req.URL.Query().Get("page[size]"))
+			mu.Unlock()
+			return next.RoundTrip(req)
+		})
+	})
+	client.SetPageSize(7)
+	client.SetPaginationBackOff(0)
+
+	// Would time out if the new PaginationBackOff was applied
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	results := client.ListAccounts(ctx, nil)
+	<-results.Channel
+	// Reconfiguration does not affect the listing in progress
+	client.SetPageSize(3)
+	client.SetPaginationBackOff(time.Hour)
+	for range results.Channel {
+	}
+	if results.Error != nil {
+		t.Fatalf("ListAccounts() failed: %s", results.Error)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(pageSizes) != 3 {
+		t.Fatalf("Expected 3 pages, fetched %v", pageSizes)
+	}
+	for _, size := range pageSizes {
+		if size != "7" {
+			t.Errorf("Expected page size 7 for all pages, fetched %v", pageSizes)
+			break
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// fetchGroup collapses the concurrent fetches of the same account into a single request, shared by the callers
+// (waiters). The shared request is not bound to the cancellation of any single caller, it's cancelled once all the
+// waiters are gone.
+type fetchGroup struct {
+	mu    sync.Mutex
+	calls map[string]*fetchCall
+}
+
+// fetchCall is a fetch in flight
+type fetchCall struct {
+	done    chan struct{}
+	account *Account
+	apiErr  *ApiError
+	// Number of callers waiting for the result
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// fetch returns the result of fetch for id, joining the call in flight if there's one. Each caller gets its own copy
+// of the result. Cancellation of ctx returns the context error to the caller only.
+func (group *fetchGroup) fetch(ctx context.Context, id string,
+	fetch func(ctx context.Context) (*Account, *ApiError)) (*Account, *ApiError) {
+	group.mu.Lock()
+	if group.calls == nil {
+		group.calls = make(map[string]*fetchCall)
+	}
+	call, ok := group.calls[id]
+	if !ok {
+		callCtx, cancel := context.WithCancel(detachedContext{ctx})
+		call = &fetchCall{done: make(chan struct{}), cancel: cancel}
+		group.calls[id] = call
+		go func() {
+			call.account, call.apiErr = fetch(callCtx)
+			group.mu.Lock()
+			if group.calls[id] == call {
+				delete(group.calls, id)
+			}
+			group.mu.Unlock()
+			cancel()
+			close(call.done)
+		}()
+	}
+	call.waiters++
+	group.mu.Unlock()
+
+	select {
+	case <-call.done:
+		var apiErr *ApiError
+		if call.apiErr != nil {
+			dup := *call.apiErr
+			apiErr = &dup
+		}
+		return copyAccount(call.account), apiErr
+
+	case <-ctx.Done():
+		group.mu.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			// The last waiter is gone, later callers start a new fetch
+			call.cancel()
+			if group.calls[id] == call {
+				delete(group.calls, id)
+			}
+		}
+		group.mu.Unlock()
+		return nil, wrapError(nil, ctx.Err())
+	}
+}
+
+// detachedContext carries the values of its parent (like the trace span), without its cancellation and deadline
+type detachedContext struct {
+	parent context.Context
+}
+
+// Implements context.Context interface
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+// Implements context.Context interface
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+// Implements context.Context interface
+func (detachedContext) Err() error {
+	return nil
+}
+
+// Implements context.Context interface
+func (ctx detachedContext) Value(key interface{}) interface{} {
+	return ctx.parent.Value(key)
+}
@@ -0,0 +1,130 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newBlockingTestServer serves account 1 once release is closed, counting the requests and the cancelled ones
+func newBlockingTestServer(t *testing.T, release chan struct{}, requests, cancelled *int32) *ApiClient {
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			atomic.AddInt32(cancelled, 1)
+			return
+		}
+		w.Header().Set("Content-Type", ContentType)
+		_, _ = w.Write([]byte(`{"data":{"id":"1","attributes":{"country":"GB"}}}`))
+	})
+	client.SetRetries(1)
+	return client
+}
+
+// waitForRequests waits until the server received n requests
+func waitForRequests(t *testing.T, requests *int32, n int32) {
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt32(requests) < n && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if atomic.LoadInt32(requests) < n {
+		t.Fatalf("Expected %d requests, received %d", n, atomic.LoadInt32(requests))
+	}
+}
+
+func TestFetchAccount_Deduplicated(t *testing.T) {
+	release := make(chan struct{})
+	var requests, cancelled int32
+	client := newBlockingTestServer(t, release, &requests, &cancelled)
+
+	const callers = 10
+	accounts := make([]*Account, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			account, apiErr := client.FetchAccount(context.Background(), "1")
+			if apiErr != nil {
+				t.Errorf("FetchAccount() failed: %s", apiErr)
+			}
+			accounts[i] = account
+		}(i)
+	}
+	waitForRequests(t, &requests, 1)
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if requests := atomic.LoadInt32(&requests); requests != 1 {
+		t.Errorf("Expected 1 request, received %d", requests)
+	}
+	// Each caller gets its own copy
+	accounts[0].Attributes.Country = "HU"
+	for i, account := range accounts[1:] {
+		if account == nil || account.Attributes.Country != "GB" {
+			t.Errorf("Unexpected account of caller %d: %v", i+1, account)
+		}
+	}
+}
+
+func TestFetchAccount_DeduplicatedCancellation(t *testing.T) {
+	release := make(chan struct{})
+	var requests, cancelled int32
+	client := newBlockingTestServer(t, release, &requests, &cancelled)
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	defer cancel1()
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	results := make(chan *ApiError, 2)
+	go func() {
+		_, apiErr := client.FetchAccount(ctx1, "1")
+		results <- apiErr
+	}()
+	waitForRequests(t, &requests, 1)
+	go func() {
+		_, apiErr := client.FetchAccount(ctx2, "1")
+		results <- apiErr
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// The first caller leaves, the shared request goes on for the second
+	cancel1()
+	if apiErr := <-results; apiErr == nil {
+		t.Fatal("Cancelled FetchAccount() succeeded")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if atomic.LoadInt32(&cancelled) != 0 {
+		t.Fatal("The shared request was cancelled while a caller was waiting")
+	}
+
+	// The last caller leaves, the shared request is cancelled
+	cancel2()
+	if apiErr := <-results; apiErr == nil {
+		t.Fatal("Cancelled FetchAccount() succeeded")
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt32(&cancelled) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if atomic.LoadInt32(&cancelled) != 1 {
+		t.Error("The shared request was not cancelled")
+	}
+
+	// A new call starts a new request
+	close(release)
+	if _, apiErr := client.FetchAccount(context.Background(), "1"); apiErr != nil {
+		t.Errorf("FetchAccount() failed: %s", apiErr)
+	}
+	if requests := atomic.LoadInt32(&requests); requests != 2 {
+		t.Errorf("Expected 2 requests, received %d", requests)
+	}
+}
@@ -3,8 +3,38 @@
 package interview_accountapi
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"strings"
+)
+
+const (
+	// ErrorCode of the ApiError of a response with an unexpected Content-Type (see ContentTypeError)
+	ErrorCodeContentType = "unexpected_content_type"
+	// ErrorCode of the ApiError of a response body exceeding the limit (see ResponseTooLargeError)
+	ErrorCodeResponseTooLarge = "response_too_large"
+)
+
+// Sentinel errors matched by ApiError through errors.Is, like errors.Is(apiErr, ErrNotFound)
+var (
+	// 404 Not Found
+	ErrNotFound = errors.New("not found")
+	// 409 Conflict, like an existing account id
+	ErrConflict = errors.New("conflict")
+	// 412 Precondition Failed, or a 409 Conflict about the version (like deleting with an outdated version)
+	ErrVersionMismatch = errors.New("version mismatch")
+	// 400 Bad Request, 422 Unprocessable Entity, or a request rejected by the client before sending it (like an
+	// Account failing Validate, or an empty account id)
+	ErrValidation = errors.New("validation failed")
+	// 429 Too Many Requests
+	ErrRateLimited = errors.New("rate limited")
+	// 502 Bad Gateway, 503 Service Unavailable, a connection failure, or the open circuit breaker
+	ErrUnavailable = errors.New("unavailable")
+	// 408 Request Timeout, 504 Gateway Timeout, a timeout of the request or its context, or the exhausted budget
+	ErrTimeout = errors.New("timeout")
 )
 
 // NewApiError creates a new ApiError from either http.Response (optional) or error message
@@ -35,3 +65,126 @@ func NewApiError(response *http.Response, format string, args ...interface{}) *A
 func (err *ApiError) Error() string {
 	return err.ErrorMessage
 }
+
+// Unwrap returns the original error (like the transport or JSON decoding error), or nil
+func (err *ApiError) Unwrap() error {
+	return err.Err
+}
+
+// Is matches the sentinel errors (like ErrNotFound) by the status code, ErrorCode and the original error
+func (err *ApiError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return err.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return err.StatusCode == http.StatusConflict
+	case ErrVersionMismatch:
+		return err.StatusCode == http.StatusPreconditionFailed ||
+			err.StatusCode == http.StatusConflict && strings.Contains(strings.ToLower(err.ErrorMessage), "version")
+	case ErrValidation:
+		return err.StatusCode == http.StatusBadRequest || err.StatusCode == http.StatusUnprocessableEntity
+	case ErrRateLimited:
+		return err.StatusCode == http.StatusTooManyRequests
+	case ErrUnavailable:
+		var netErr net.Error
+		return err.StatusCode == http.StatusBadGateway || err.StatusCode == http.StatusServiceUnavailable ||
+			err.ErrorCode == ErrorCodeCircuitOpen ||
+			errors.As(err.Err, &netErr) && !netErr.Timeout() && !errors.Is(err.Err, context.Canceled)
+	case ErrTimeout:
+		var netErr net.Error
+		return err.StatusCode == http.StatusRequestTimeout || err.StatusCode == http.StatusGatewayTimeout ||
+			err.ErrorCode == ErrorCodeBudgetExhausted || errors.Is(err.Err, context.DeadlineExceeded) ||
+			errors.As(err.Err, &netErr) && netErr.Timeout()
+	}
+	return false
+}
+
+// IsRetryable tells whether repeating the failed operation of err could succeed: transport errors and recoverable
+// status codes are retryable (the same decision as the retries of Do), validation errors and cancellations are not.
+func IsRetryable(err error) bool {
+	var apiErr *ApiError
+	if !errors.As(err, &apiErr) {
+		return err != nil && !errors.Is(err, context.Canceled) && retryableFailure(0, err)
+	}
+	if errors.Is(apiErr.Err, context.Canceled) || errors.Is(apiErr, ErrValidation) {
+		return false
+	}
+	if apiErr.StatusCode == 0 && apiErr.Err == nil {
+		return false
+	}
+	return retryableFailure(apiErr.StatusCode, apiErr.Err)
+}
+
+// IsTemporary tells whether err is caused by a condition expected to clear with time: ErrRateLimited, ErrUnavailable
+// or ErrTimeout.
+func IsTemporary(err error) bool {
+	return errors.Is(err, ErrRateLimited) || errors.Is(err, ErrUnavailable) || errors.Is(err, ErrTimeout)
+}
+
+// wrapError creates an ApiError of err, which is kept as the original error, with the status code of response
+// (optional)
+func wrapError(response *http.Response, err error) *ApiError {
+	apiErr := NewApiError(response, err.Error())
+	apiErr.Err = err
+	return apiErr
+}
+
+// newValidationError creates the ApiError of a request rejected by the client before sending it, matching
+// ErrValidation
+func newValidationError(err error) *ApiError {
+	apiErr := NewApiError(nil, err.Error())
+	apiErr.Err = &validationError{err}
+	return apiErr
+}
+
+// validationError is the original error of a request rejected by the client, matching ErrValidation
+type validationError struct {
+	err error
+}
+
+// Implements Error interface
+func (err *validationError) Error() string {
+	return err.err.Error()
+}
+
+// Unwrap returns the error of the validation
+func (err *validationError) Unwrap() error {
+	return err.err
+}
+
+// Is matches ErrValidation
+func (err *validationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// newDecodeError creates an ApiError of a failure decoding the body of a successful response
+func newDecodeError(response *http.Response, err error) *ApiError {
+	apiErr := wrapError(nil, err)
+	apiErr.StatusCode = statusCode(response)
+	var tooLarge *ResponseTooLargeError
+	if errors.As(err, &tooLarge) {
+		apiErr.ErrorCode = ErrorCodeResponseTooLarge
+	}
+	return apiErr
+}
+
+// ContentTypeError is the error of a response without a JSON media type
+type ContentTypeError struct {
+	// The Content-Type header of the response
+	ContentType string
+}
+
+// Implements Error interface
+func (err *ContentTypeError) Error() string {
+	return fmt.Sprintf("Received unknown Content-Type: %q", err.ContentType)
+}
+
+// ResponseTooLargeError is the error of reading a response body beyond the maximum size
+type ResponseTooLargeError struct {
+	Limit int64
+}
+
+// Implements Error interface
+func (err *ResponseTooLargeError) Error() string {
+	return fmt.Sprintf("Response body exceeds the limit of %d bytes", err.Limit)
+}
@@ -0,0 +1,133 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApiError_IsStatus(t *testing.T) {
+	// Responds with the status code of the account id
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		status, _ := strconv.Atoi(r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:])
+		w.Header().Set("Content-Type", ContentType)
+		w.WriteHeader(status)
+		if status == http.StatusConflict {
+			_, _ = w.Write([]byte(`{"error_message":"invalid version"}`))
+		}
+	})
+	client.SetRetries(1)
+
+	sentinels := []error{ErrNotFound, ErrConflict, ErrVersionMismatch, ErrValidation, ErrRateLimited, ErrUnavailable,
+		ErrTimeout}
+	for status, expected := range map[int][]error{
+		http.StatusNotFound:            {ErrNotFound},
+		http.StatusConflict:            {ErrConflict, ErrVersionMismatch},
+		http.StatusPreconditionFailed:  {ErrVersionMismatch},
+		http.StatusBadRequest:          {ErrValidation},
+		http.StatusTooManyRequests:     {ErrRateLimited},
+		http.StatusServiceUnavailable:  {ErrUnavailable},
+		http.StatusGatewayTimeout:      {ErrTimeout},
+		http.StatusInternalServerError: {},
+	} {
+		_, apiErr := client.FetchAccount(context.Background(), strconv.Itoa(status))
+		if apiErr == nil {
+			t.Fatalf("FetchAccount() of status %d succeeded", status)
+		}
+		for _, sentinel := range sentinels {
+			matching := false
+			for _, e := range expected {
+				matching = matching || e == sentinel
+			}
+			if errors.Is(apiErr, sentinel) != matching {
+				t.Errorf("errors.Is(status %d, %s) = %v", status, sentinel, !matching)
+			}
+		}
+		if retryable := retryableStatus(status); IsRetryable(apiErr) != retryable {
+			t.Errorf("IsRetryable(status %d) = %v", status, !retryable)
+		}
+	}
+}
+
+func TestApiError_Validation(t *testing.T) {
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Invalid request was sent")
+	})
+
+	_, apiErr := client.UpdateAccount(context.Background(), "", &Account{})
+	if !errors.Is(apiErr, ErrValidation) || IsRetryable(apiErr) || IsTemporary(apiErr) {
+		t.Errorf("Unexpected empty id error: %v", apiErr)
+	}
+	_, apiErr = client.CreateAccount(context.Background(), &Account{Id: "1"})
+	if !errors.Is(apiErr, ErrValidation) || apiErr.Error() != "Account.OrganisationId can not be empty" {
+		t.Errorf("Unexpected invalid account error: %v", apiErr)
+	}
+	results := client.ListAccounts(context.Background(), map[string]string{"colour": "red"})
+	for range results.Channel {
+	}
+	if !errors.Is(results.Error, ErrValidation) {
+		t.Errorf("Unexpected invalid filter error: %v", results.Error)
+	}
+}
+
+func TestApiError_TransportErrors(t *testing.T) {
+	client, server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	})
+	client.SetRetries(1)
+
+	// Timeout
+	client.SetTimeout(20 * time.Millisecond)
+	_, apiErr := client.FetchAccount(context.Background(), "1")
+	if !errors.Is(apiErr, ErrTimeout) || !IsTemporary(apiErr) || !IsRetryable(apiErr) {
+		t.Errorf("Unexpected timeout error: %v", apiErr)
+	}
+	var urlErr *url.Error
+	if !errors.As(apiErr, &urlErr) {
+		t.Errorf("The transport error is not kept: %#v", apiErr.Err)
+	}
+
+	// Cancellation
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, apiErr = client.FetchAccount(ctx, "1")
+	if !errors.Is(apiErr, context.Canceled) || IsRetryable(apiErr) {
+		t.Errorf("Unexpected cancellation error: %v", apiErr)
+	}
+
+	// Connection failure
+	server.Close()
+	_, apiErr = client.FetchAccount(context.Background(), "1")
+	if !errors.Is(apiErr, ErrUnavailable) || errors.Is(apiErr, ErrTimeout) || !IsRetryable(apiErr) {
+		t.Errorf("Unexpected connection error: %v", apiErr)
+	}
+}
+
+func TestApiError_ErrorCodes(t *testing.T) {
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<html></html>"))
+	})
+
+	_, apiErr := client.FetchAccount(context.Background(), "1")
+	var contentTypeErr *ContentTypeError
+	if !errors.As(apiErr, &contentTypeErr) || contentTypeErr.ContentType != "text/html" {
+		t.Errorf("Unexpected content type error: %#v", apiErr)
+	}
+
+	breaker := NewCircuitBreaker(CircuitBreakerSettings{Window: 1, MinRequests: 1})
+	done, _ := breaker.Allow()
+	done(true)
+	client.SetCircuitBreaker(breaker)
+	_, apiErr = client.FetchAccount(context.Background(), "1")
+	if !errors.Is(apiErr, ErrUnavailable) || !IsTemporary(apiErr) || IsRetryable(apiErr) {
+		t.Errorf("Unexpected circuit open error: %v", apiErr)
+	}
+}
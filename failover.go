@@ -0,0 +1,258 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EndpointSettings configure an EndpointPool, zero values are replaced by defaults
+type EndpointSettings struct {
+	// An endpoint failing with a retryable error is skipped for this long, unless a probe succeeds earlier
+	// (default 30s)
+	Cooldown time.Duration
+	// Interval of probing the unhealthy endpoints (default 5s)
+	ProbeInterval time.Duration
+	// Path of the probe GET request relative to the base URL, responses below 500 are healthy (default "v1/health")
+	ProbePath string
+	// HTTP client of the probes (default http.DefaultClient)
+	HTTPClient *http.Client
+}
+
+// EndpointPool is an ordered list of base URLs of the same API (like regions) to fail over between.
+//
+// Each attempt of Do goes to the first healthy endpoint. An endpoint failing with a transport error or a 5xx status
+// is marked unhealthy for the Cooldown, so the retry goes to the next one. Unhealthy endpoints are probed in the
+// background, and become healthy again once a probe succeeds or the Cooldown ends. When all of them are unhealthy,
+// the one closest to the end of its Cooldown is used. Safe for concurrent use, and may be shared by multiple clients.
+type EndpointPool struct {
+	settings EndpointSettings
+
+	mu        sync.Mutex
+	endpoints []*endpoint
+	// Whether the probing go-routine is running
+	probing bool
+}
+
+// endpoint is a base URL of an EndpointPool
+type endpoint struct {
+	base *url.URL
+	// String form of base, ending with a slash
+	prefix string
+	// The endpoint is unhealthy until then
+	unhealthyUntil time.Time
+}
+
+// NewEndpointPool creates an EndpointPool of the base URLs in order of preference, all endpoints being healthy
+func NewEndpointPool(baseURLs []string, settings EndpointSettings) (*EndpointPool, error) {
+	if len(baseURLs) == 0 {
+		return nil, errors.New("no base URLs")
+	}
+	if settings.Cooldown <= 0 {
+		settings.Cooldown = 30 * time.Second
+	}
+	if settings.ProbeInterval <= 0 {
+		settings.ProbeInterval = 5 * time.Second
+	}
+	if settings.ProbePath == "" {
+		settings.ProbePath = "v1/health"
+	}
+	if settings.HTTPClient == nil {
+		settings.HTTPClient = http.DefaultClient
+	}
+
+	pool := &EndpointPool{settings: settings}
+	for _, baseURL := range baseURLs {
+		u, err := url.Parse(baseURL)
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("base URL %q shall be http or https", baseURL)
+		}
+		if !strings.HasSuffix(u.Path, "/") {
+			u.Path += "/"
+		}
+		pool.endpoints = append(pool.endpoints, &endpoint{base: u, prefix: u.String()})
+	}
+	return pool, nil
+}
+
+// BaseURLs returns the base URLs of the endpoints in order of preference
+func (pool *EndpointPool) BaseURLs() []string {
+	baseURLs := make([]string, len(pool.endpoints))
+	for i, e := range pool.endpoints {
+		baseURLs[i] = e.prefix
+	}
+	return baseURLs
+}
+
+// Healthy tells whether the endpoint of baseURL is considered healthy
+func (pool *EndpointPool) Healthy(baseURL string) bool {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	for _, e := range pool.endpoints {
+		if e.prefix == baseURL || e.base.String() == baseURL {
+			return !time.Now().Before(e.unhealthyUntil)
+		}
+	}
+	return false
+}
+
+// pick returns the first healthy endpoint, or the one closest to the end of its cooldown
+func (pool *EndpointPool) pick() *endpoint {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	now := time.Now()
+	best := pool.endpoints[0]
+	for _, e := range pool.endpoints {
+		if !now.Before(e.unhealthyUntil) {
+			return e
+		}
+		if e.unhealthyUntil.Before(best.unhealthyUntil) {
+			best = e
+		}
+	}
+	return best
+}
+
+// endpointOf returns the endpoint whose base URL is the prefix of link, or nil
+func (pool *EndpointPool) endpointOf(link string) *endpoint {
+	for _, e := range pool.endpoints {
+		if strings.HasPrefix(link, e.prefix) {
+			return e
+		}
+	}
+	return nil
+}
+
+// rebase returns u moved from its endpoint to target, or u if it's not for an endpoint of the pool
+func (pool *EndpointPool) rebase(u *url.URL, target *endpoint) *url.URL {
+	link := u.String()
+	current := pool.endpointOf(link)
+	if current == nil || current == target {
+		return u
+	}
+	rebased, err := url.Parse(target.prefix + strings.TrimPrefix(link, current.prefix))
+	if err != nil {
+		return u
+	}
+	return rebased
+}
+
+// relative returns link relative to the base URL of its endpoint, or link if it's not for an endpoint of the pool
+func (pool *EndpointPool) relative(link string) string {
+	if e := pool.endpointOf(link); e != nil {
+		return strings.TrimPrefix(link, e.prefix)
+	}
+	return link
+}
+
+// markUnhealthy puts e in cooldown, and starts probing the unhealthy endpoints
+func (pool *EndpointPool) markUnhealthy(e *endpoint) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	e.unhealthyUntil = time.Now().Add(pool.settings.Cooldown)
+	if !pool.probing {
+		pool.probing = true
+		go pool.probeUnhealthy()
+	}
+}
+
+// probeUnhealthy probes the unhealthy endpoints periodically, until all of them are healthy
+func (pool *EndpointPool) probeUnhealthy() {
+	ticker := time.NewTicker(pool.settings.ProbeInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		var unhealthy []*endpoint
+		pool.mu.Lock()
+		now := time.Now()
+		for _, e := range pool.endpoints {
+			if now.Before(e.unhealthyUntil) {
+				unhealthy = append(unhealthy, e)
+			}
+		}
+		if len(unhealthy) == 0 {
+			pool.probing = false
+			pool.mu.Unlock()
+			return
+		}
+		pool.mu.Unlock()
+
+		for _, e := range unhealthy {
+			if pool.probe(e) {
+				pool.mu.Lock()
+				e.unhealthyUntil = time.Time{}
+				pool.mu.Unlock()
+			}
+		}
+	}
+}
+
+// probe tells whether e responds to the probe request
+func (pool *EndpointPool) probe(e *endpoint) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), pool.settings.ProbeInterval)
+	defer cancel()
+	probeURL, err := e.base.Parse(pool.settings.ProbePath)
+	if err != nil {
+		return false
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, probeURL.String(), nil)
+	if err != nil {
+		return false
+	}
+	resp, err := pool.settings.HTTPClient.Do(req)
+	if err != nil {
+		return false
+	}
+	_ = resp.Body.Close()
+	return resp.StatusCode < 500
+}
+
+// Context key type of the endpoint serving an attempt
+type endpointKey struct{}
+
+// withEndpoint returns a copy of ctx carrying the base URL of the endpoint of the attempt
+func withEndpoint(ctx context.Context, baseURL string) context.Context {
+	return context.WithValue(ctx, endpointKey{}, baseURL)
+}
+
+// EndpointFromContext returns the base URL of the endpoint from the context of a request passed to a Middleware by
+// ApiClient.Do, or "" if the client has no EndpointPool.
+func EndpointFromContext(ctx context.Context) string {
+	baseURL, _ := ctx.Value(endpointKey{}).(string)
+	return baseURL
+}
+
+// ServedBy returns the base URL of the endpoint which served resp (as returned by Do or passed to Hooks), or "" if
+// the client has no EndpointPool.
+func ServedBy(resp *http.Response) string {
+	if resp == nil || resp.Request == nil {
+		return ""
+	}
+	return EndpointFromContext(resp.Request.Context())
+}
+
+// Gets the EndpointPool of the client, or nil
+func (client *ApiClient) Endpoints() *EndpointPool {
+	return client.snapshot().endpoints
+}
+
+// Sets an EndpointPool to fail over between, also setting the base URL to its first endpoint. nil disables failover,
+// keeping the base URL.
+func (client *ApiClient) SetEndpoints(pool *EndpointPool) {
+	client.update(func(config *clientConfig) {
+		config.endpoints = pool
+		if pool != nil {
+			config.baseURL = pool.endpoints[0].base
+		}
+	})
+}
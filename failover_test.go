@@ -0,0 +1,185 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newEndpointServer starts a test server counting its requests
+func newEndpointServer(t *testing.T, requests *int32, handler http.HandlerFunc) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// serveAccount responds with the account 1
+func serveAccount(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	_, _ = w.Write([]byte(`{"data":{"id":"1"}}`))
+}
+
+func TestEndpointPool_Failover(t *testing.T) {
+	var primaryRequests, secondaryRequests int32
+	primary := newEndpointServer(t, &primaryRequests, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	secondary := newEndpointServer(t, &secondaryRequests, serveAccount)
+
+	client, err := NewApiClient(WithBaseURLs(primary.URL, secondary.URL))
+	if err != nil {
+		t.Fatalf("NewApiClient() failed: %s", err)
+	}
+	client.SetErrorBackOff(0)
+	var mu sync.Mutex
+	var servedBy []string
+	client.AddHooks(Hooks{AfterResponse: func(req *http.Request, resp *http.Response, err error) {
+		mu.Lock()
+		servedBy = append(servedBy, ServedBy(resp))
+		mu.Unlock()
+	}})
+
+	for i := 0; i < 2; i++ {
+		if _, apiErr := client.FetchAccount(context.Background(), "1"); apiErr != nil {
+			t.Fatalf("FetchAccount() failed: %s", apiErr)
+		}
+	}
+	// The unhealthy primary is skipped after the failure
+	if requests := atomic.LoadInt32(&primaryRequests); requests != 1 {
+		t.Errorf("Expected 1 request to the primary, received %d", requests)
+	}
+	if requests := atomic.LoadInt32(&secondaryRequests); requests != 2 {
+		t.Errorf("Expected 2 requests to the secondary, received %d", requests)
+	}
+	if client.Endpoints().Healthy(primary.URL + "/") {
+		t.Error("The primary is healthy")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := fmt.Sprint([]string{primary.URL + "/", secondary.URL + "/", secondary.URL + "/"})
+	if fmt.Sprint(servedBy) != expected {
+		t.Errorf("Expected served by %s, got %v", expected, servedBy)
+	}
+}
+
+func TestEndpointPool_ProbeRecovers(t *testing.T) {
+	var primaryRequests, secondaryRequests int32
+	var down int32 = 1
+	primary := newEndpointServer(t, &primaryRequests, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/health" && atomic.LoadInt32(&down) == 0 {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if atomic.LoadInt32(&down) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		serveAccount(w, r)
+	})
+	secondary := newEndpointServer(t, &secondaryRequests, serveAccount)
+
+	pool, err := NewEndpointPool([]string{primary.URL, secondary.URL},
+		EndpointSettings{Cooldown: time.Hour, ProbeInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewEndpointPool() failed: %s", err)
+	}
+	client, _ := newTestServer(t, serveAccount)
+	client.SetEndpoints(pool)
+	client.SetErrorBackOff(0)
+
+	if _, apiErr := client.FetchAccount(context.Background(), "1"); apiErr != nil {
+		t.Fatalf("FetchAccount() failed: %s", apiErr)
+	}
+	if pool.Healthy(primary.URL + "/") {
+		t.Fatal("The primary is healthy")
+	}
+
+	atomic.StoreInt32(&down, 0)
+	deadline := time.Now().Add(2 * time.Second)
+	for !pool.Healthy(primary.URL+"/") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !pool.Healthy(primary.URL + "/") {
+		t.Fatal("The primary did not recover")
+	}
+
+	before := atomic.LoadInt32(&secondaryRequests)
+	if _, apiErr := client.FetchAccount(context.Background(), "1"); apiErr != nil {
+		t.Fatalf("FetchAccount() failed: %s", apiErr)
+	}
+	if requests := atomic.LoadInt32(&secondaryRequests); requests != before {
+		t.Error("The recovered primary was not used")
+	}
+}
+
+func TestEndpointPool_ListAccountsFailover(t *testing.T) {
+	// Serves the pages of 1 account each, with absolute links to the next page of the same endpoint
+	servePage := func(baseURL *string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			page, _ := strconv.Atoi(r.URL.Query().Get("page[number]"))
+			next := ""
+			if page < 2 {
+				next = fmt.Sprintf(`,"links":{"next":"%s/%s?page[number]=%d"}`, *baseURL, AccountsPath, page+1)
+			}
+			w.Header().Set("Content-Type", ContentType)
+			_, _ = fmt.Fprintf(w, `{"data":[{"id":"%d"}]%s}`, page, next)
+		}
+	}
+	var primaryURL, secondaryURL string
+	var primaryRequests, secondaryRequests int32
+	primary := newEndpointServer(t, &primaryRequests, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page[number]") != "" {
+			// Fails after the first page
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		servePage(&primaryURL)(w, r)
+	})
+	secondary := newEndpointServer(t, &secondaryRequests, servePage(&secondaryURL))
+	primaryURL, secondaryURL = primary.URL, secondary.URL
+
+	client, err := NewApiClient(WithBaseURLs(primary.URL, secondary.URL))
+	if err != nil {
+		t.Fatalf("NewApiClient() failed: %s", err)
+	}
+	client.SetErrorBackOff(0)
+	client.SetPaginationBackOff(0)
+
+	var ids []string
+	results := client.ListAccounts(context.Background(), nil)
+	for account := range results.Channel {
+		ids = append(ids, account.Id)
+	}
+	if results.Error != nil {
+		t.Fatalf("ListAccounts() failed: %s", results.Error)
+	}
+	if fmt.Sprint(ids) != "[0 1 2]" {
+		t.Errorf("Unexpected accounts listed: %v", ids)
+	}
+	if requests := atomic.LoadInt32(&primaryRequests); requests != 2 {
+		t.Errorf("Expected 2 requests to the primary, received %d", requests)
+	}
+	if requests := atomic.LoadInt32(&secondaryRequests); requests != 2 {
+		t.Errorf("Expected 2 requests to the secondary, received %d", requests)
+	}
+}
+
+func TestNewEndpointPool_Invalid(t *testing.T) {
+	for _, baseURLs := range [][]string{nil, {"ftp://example.com/"}, {"https://example.com/", "%"}} {
+		if _, err := NewEndpointPool(baseURLs, EndpointSettings{}); err == nil {
+			t.Errorf("NewEndpointPool() accepted %v", baseURLs)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// Tells whether responses are requested gzip compressed
+func (client *ApiClient) AcceptGzip() bool {
+	return client.snapshot().acceptGzip
+}
+
+// Sets whether to request gzip compressed responses with the Accept-Encoding header (enabled by default).
+// Compressed responses are decoded by the client, whatever transport is used.
+func (client *ApiClient) SetAcceptGzip(accept bool) {
+	client.update(func(config *clientConfig) { config.acceptGzip = accept })
+}
+
+// Gets the size of request bodies from which they are gzip compressed, 0 if disabled
+func (client *ApiClient) GzipRequestThreshold() int64 {
+	return client.snapshot().gzipThreshold
+}
+
+// Sets the size of request bodies from which Do compresses them with gzip (and sets Content-Encoding), bodies of unknown
+// length are compressed too. The compressed body is kept in memory to be replayed for retries.
+// 0 or less disables it (the default), as the API has to support compressed requests.
+func (client *ApiClient) SetGzipRequestThreshold(size int64) {
+	if size < 0 {
+		size = 0
+	}
+	client.update(func(config *clientConfig) { config.gzipThreshold = size })
+}
+
+// gzipRequest compresses the body of req if enabled and the body is large enough (or of unknown length),
+// unless it already has a Content-Encoding
+func (config *clientConfig) gzipRequest(req *http.Request) error {
+	if config.gzipThreshold <= 0 || req.Body == nil || req.Body == http.NoBody ||
+		req.Header.Get("Content-Encoding") != "" ||
+		(req.ContentLength > 0 && req.ContentLength < config.gzipThreshold) {
+		return nil
+	}
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	_, err := io.Copy(zw, req.Body)
+	if e := req.Body.Close(); err == nil {
+		err = e
+	}
+	if e := zw.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+
+	data := compressed.Bytes()
+	req.Body = ioutil.NopCloser(bytes.NewReader(data))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+	req.ContentLength = int64(len(data))
+	req.Header.Set("Content-Encoding", "gzip")
+	return nil
+}
+
+// gunzip wraps the transport, requesting gzip compressed responses (unless the request has its own Accept-Encoding)
+// and decoding them.
+//
+// Setting Accept-Encoding disables the transparent decompression of http.Transport, so compressed responses are
+// decoded the same way with any transport.
+func gunzip(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get("Accept-Encoding") == "" {
+			req = req.Clone(req.Context())
+			req.Header.Set("Accept-Encoding", "gzip")
+		}
+
+		resp, err := next.RoundTrip(req)
+		if err != nil || resp == nil || !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+			return resp, err
+		}
+
+		resp.Body = &gzipBody{body: resp.Body}
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		resp.Uncompressed = true
+		return resp, nil
+	})
+}
+
+// gzipBody decodes a gzip compressed response body, lazily on the first read as the body may be empty
+type gzipBody struct {
+	body io.ReadCloser
+	zr   *gzip.Reader
+	err  error
+}
+
+// Implements io.Reader interface
+func (body *gzipBody) Read(p []byte) (int, error) {
+	if body.zr == nil && body.err == nil {
+		body.zr, body.err = gzip.NewReader(body.body)
+	}
+	if body.err != nil {
+		return 0, body.err
+	}
+	return body.zr.Read(p)
+}
+
+// Implements io.Closer interface
+func (body *gzipBody) Close() error {
+	return body.body.Close()
+}
@@ -0,0 +1,138 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func gzipped(t *testing.T, data string) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGzip_Response(t *testing.T) {
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != "gzip" {
+			t.Errorf("Expected Accept-Encoding gzip, received %q", r.Header.Get("Accept-Encoding"))
+		}
+		w.Header().Set("Content-Type", ContentType)
+		w.Header().Set("Content-Encoding", "gzip")
+		_, _ = w.Write(gzipped(t, `{"data":{"id":"1"}}`))
+	})
+
+	account, apiErr := client.FetchAccount(context.Background(), "1")
+	if apiErr != nil {
+		t.Fatalf("FetchAccount() failed: %s", apiErr)
+	}
+	if account.Id != "1" {
+		t.Errorf("Unexpected account: %v", account)
+	}
+}
+
+func TestGzip_ResponseOfCustomTransport(t *testing.T) {
+	client, err := NewApiClient(WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		header := http.Header{}
+		header.Set("Content-Type", ContentType)
+		if req.Header.Get("Accept-Encoding") == "gzip" {
+			header.Set("Content-Encoding", "gzip")
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     header,
+			Body:       ioutil.NopCloser(bytes.NewReader(gzipped(t, `{"data":{"id":"2"}}`))),
+			Request:    req,
+		}, nil
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	account, apiErr := client.FetchAccount(context.Background(), "2")
+	if apiErr != nil {
+		t.Fatalf("FetchAccount() failed: %s", apiErr)
+	}
+	if account.Id != "2" {
+		t.Errorf("Unexpected account: %v", account)
+	}
+}
+
+func TestGzip_RequestReplayed(t *testing.T) {
+	payload := map[string]string{"id": strings.Repeat("1", 100)}
+
+	var mu sync.Mutex
+	var bodies []string
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "gzip" || r.ContentLength <= 0 {
+			t.Errorf("Expected a gzip request of known length, received Content-Encoding %q and Content-Length %d",
+				r.Header.Get("Content-Encoding"), r.ContentLength)
+		}
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Errorf("Failed decoding request body: %s", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		data, err := ioutil.ReadAll(zr)
+		if err != nil {
+			t.Errorf("Failed decoding request body: %s", err)
+		}
+
+		mu.Lock()
+		bodies = append(bodies, string(data))
+		first := len(bodies) == 1
+		mu.Unlock()
+		if first {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", ContentType)
+		_, _ = w.Write([]byte(`{"data":{}}`))
+	})
+	client.SetErrorBackOff(0)
+	client.SetGzipRequestThreshold(64)
+
+	resp, _, apiErr := client.JsonRequest(context.Background(), http.MethodPost, AccountsPath, payload)
+	if apiErr != nil {
+		t.Fatalf("JsonRequest() failed: %s", apiErr)
+	}
+	_ = resp.Body.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := `{"id":"` + payload["id"] + `"}`
+	if len(bodies) != 2 || bodies[0] != expected || bodies[1] != expected {
+		t.Errorf("Expected the compressed body twice, received %q", bodies)
+	}
+}
+
+func TestGzip_RequestBelowThreshold(t *testing.T) {
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "" {
+			t.Errorf("Small request was compressed")
+		}
+		w.Header().Set("Content-Type", ContentType)
+		_, _ = w.Write([]byte(`{"data":{}}`))
+	})
+	client.SetGzipRequestThreshold(1024)
+
+	resp, _, apiErr := client.JsonRequest(context.Background(), http.MethodPost, AccountsPath, map[string]int{"a": 1})
+	if apiErr != nil {
+		t.Fatalf("JsonRequest() failed: %s", apiErr)
+	}
+	_ = resp.Body.Close()
+}
@@ -0,0 +1,331 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Headers redacted by HARRecorder by default
+var harRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Signature"}
+
+// HARSettings configure a HARRecorder, zero values are replaced by defaults
+type HARSettings struct {
+	// Request and response bodies are captured up to this size (default 1 MiB), -1 disables capturing bodies
+	MaxBodySize int64
+	// Headers to redact in addition to Authorization, Proxy-Authorization and Signature
+	RedactHeaders []string
+}
+
+// HARRecorder is a Middleware capturing each attempt of the requests (including retries) with their responses,
+// timings, headers and bodies, to be written as a HAR 1.2 file which browser devtools can open.
+//
+// The values of the Authorization, Proxy-Authorization and Signature headers are redacted. To capture the headers
+// set by the other middlewares (like HTTPSigner) it shall be used last, being the innermost. The request body is
+// captured through GetBody, the response body as it's read by the caller. Safe for concurrent use.
+//
+//	recorder := NewHARRecorder(HARSettings{})
+//	client.Use(recorder.Middleware)
+//	...
+//	err := recorder.WriteFile("accountapi.har")
+type HARRecorder struct {
+	settings HARSettings
+	redact   map[string]bool
+
+	mu      sync.Mutex
+	entries []*harEntry
+}
+
+// NewHARRecorder creates an empty HARRecorder
+func NewHARRecorder(settings HARSettings) *HARRecorder {
+	if settings.MaxBodySize == 0 {
+		settings.MaxBodySize = 1 << 20
+	}
+	redact := make(map[string]bool)
+	for _, name := range append(append([]string(nil), harRedactedHeaders...), settings.RedactHeaders...) {
+		redact[http.CanonicalHeaderKey(name)] = true
+	}
+	return &HARRecorder{settings: settings, redact: redact}
+}
+
+// Middleware records each attempt passing through it
+func (recorder *HARRecorder) Middleware(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		entry := &harEntry{
+			StartedDateTime: time.Now().Format("2006-01-02T15:04:05.000Z07:00"),
+			Request:         recorder.harRequest(req),
+			Cache:           struct{}{},
+		}
+		if attempt := AttemptFromContext(req.Context()); attempt > 0 {
+			entry.Comment = fmt.Sprintf("attempt %d", attempt)
+		}
+		recorder.mu.Lock()
+		recorder.entries = append(recorder.entries, entry)
+		recorder.mu.Unlock()
+
+		start := time.Now()
+		resp, err := next.RoundTrip(req)
+		wait := time.Since(start)
+
+		recorder.mu.Lock()
+		defer recorder.mu.Unlock()
+		entry.Timings.Wait = milliseconds(wait)
+		entry.Time = entry.Timings.Wait
+		if err != nil || resp == nil {
+			entry.Response = harResponse{Headers: []harNameValue{}, Cookies: []harNameValue{},
+				Content: harContent{MimeType: "x-unknown"}, HeadersSize: -1, BodySize: -1}
+			if err != nil && entry.Comment != "" {
+				entry.Comment += fmt.Sprintf(", error: %s", err)
+			} else if err != nil {
+				entry.Comment = fmt.Sprintf("error: %s", err)
+			}
+			return resp, err
+		}
+
+		entry.Response = harResponse{
+			Status:      resp.StatusCode,
+			StatusText:  http.StatusText(resp.StatusCode),
+			HTTPVersion: resp.Proto,
+			Cookies:     []harNameValue{},
+			Headers:     recorder.harHeaders(resp.Header),
+			Content:     harContent{MimeType: resp.Header.Get("Content-Type")},
+			RedirectURL: resp.Header.Get("Location"),
+			HeadersSize: -1,
+			BodySize:    -1,
+		}
+		resp.Body = &harBody{ReadCloser: resp.Body, recorder: recorder, entry: entry, start: start.Add(wait)}
+		return resp, nil
+	})
+}
+
+// harRequest captures req, with its body if it can be re-read through GetBody
+func (recorder *HARRecorder) harRequest(req *http.Request) harRequest {
+	request := harRequest{
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		HTTPVersion: req.Proto,
+		Cookies:     []harNameValue{},
+		Headers:     recorder.harHeaders(req.Header),
+		QueryString: []harNameValue{},
+		HeadersSize: -1,
+		BodySize:    req.ContentLength,
+	}
+	for name, values := range req.URL.Query() {
+		for _, value := range values {
+			request.QueryString = append(request.QueryString, harNameValue{name, value})
+		}
+	}
+
+	if req.GetBody != nil && req.ContentLength != 0 && recorder.settings.MaxBodySize > 0 {
+		if body, err := req.GetBody(); err == nil {
+			data, _ := ioutil.ReadAll(io.LimitReader(body, recorder.settings.MaxBodySize))
+			_ = body.Close()
+			text, _ := harText(data)
+			request.PostData = &harPostData{MimeType: req.Header.Get("Content-Type"), Text: text}
+		}
+	}
+	return request
+}
+
+// harHeaders returns header with the redacted values
+func (recorder *HARRecorder) harHeaders(header http.Header) []harNameValue {
+	headers := []harNameValue{}
+	for name, values := range header {
+		for _, value := range values {
+			if recorder.redact[http.CanonicalHeaderKey(name)] {
+				value = "REDACTED"
+			}
+			headers = append(headers, harNameValue{name, value})
+		}
+	}
+	return headers
+}
+
+// Len returns the number of the recorded entries
+func (recorder *HARRecorder) Len() int {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	return len(recorder.entries)
+}
+
+// Reset discards the recorded entries
+func (recorder *HARRecorder) Reset() {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	recorder.entries = nil
+}
+
+// WriteTo writes the recorded entries as HAR 1.2 JSON. Implements io.WriterTo interface.
+func (recorder *HARRecorder) WriteTo(w io.Writer) (int64, error) {
+	recorder.mu.Lock()
+	var har harFile
+	har.Log.Version = "1.2"
+	har.Log.Creator = harCreator{Name: "interview-accountapi", Version: "1.0"}
+	har.Log.Entries = make([]harEntry, len(recorder.entries))
+	for i, entry := range recorder.entries {
+		har.Log.Entries[i] = *entry
+	}
+	data, err := json.MarshalIndent(&har, "", "  ")
+	recorder.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(data)
+	return int64(n), err
+}
+
+// WriteFile writes the recorded entries to the HAR file of name
+func (recorder *HARRecorder) WriteFile(name string) error {
+	var buf bytes.Buffer
+	if _, err := recorder.WriteTo(&buf); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, buf.Bytes(), 0600)
+}
+
+// harBody captures a response body as it's read, up to MaxBodySize
+type harBody struct {
+	io.ReadCloser
+	recorder *HARRecorder
+	entry    *harEntry
+	// Time of receiving the response headers
+	start time.Time
+	data  []byte
+	size  int64
+	done  bool
+}
+
+// Implements io.Reader interface
+func (body *harBody) Read(p []byte) (int, error) {
+	n, err := body.ReadCloser.Read(p)
+	body.size += int64(n)
+	if remaining := body.recorder.settings.MaxBodySize - int64(len(body.data)); remaining > 0 {
+		if int64(n) < remaining {
+			remaining = int64(n)
+		}
+		body.data = append(body.data, p[:remaining]...)
+	}
+	if err == io.EOF {
+		body.finish()
+	}
+	return n, err
+}
+
+// Implements io.Closer interface
+func (body *harBody) Close() error {
+	err := body.ReadCloser.Close()
+	body.finish()
+	return err
+}
+
+// finish records the captured body and the receive time into the entry, once
+func (body *harBody) finish() {
+	if body.done {
+		return
+	}
+	body.done = true
+	recorder := body.recorder
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	body.entry.Timings.Receive = milliseconds(time.Since(body.start))
+	body.entry.Time = body.entry.Timings.Wait + body.entry.Timings.Receive
+	body.entry.Response.BodySize = body.size
+	body.entry.Response.Content.Size = body.size
+	if recorder.settings.MaxBodySize > 0 {
+		body.entry.Response.Content.Text, body.entry.Response.Content.Encoding = harText(body.data)
+	}
+}
+
+// harText returns data as text, base64 encoded if it's not valid UTF-8
+func harText(data []byte) (string, string) {
+	if utf8.Valid(data) {
+		return string(data), ""
+	}
+	return base64.StdEncoding.EncodeToString(data), "base64"
+}
+
+// milliseconds returns d in milliseconds, as timings are represented in HAR
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// HAR 1.2 structures (http://www.softwareishard.com/blog/har-12-spec/)
+
+type harFile struct {
+	Log struct {
+		Version string     `json:"version"`
+		Creator harCreator `json:"creator"`
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
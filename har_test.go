@@ -0,0 +1,99 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHARRecorder_RecordsAttempts(t *testing.T) {
+	var requests int32
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", ContentType)
+		_, _ = w.Write([]byte(`{"data":{"id":"1","version":1}}`))
+	})
+	client.SetErrorBackOff(0)
+	recorder := NewHARRecorder(HARSettings{})
+	client.Use(func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req.Header.Set("Authorization", `Signature keyId="key",signature="secret"`)
+			return next.RoundTrip(req)
+		})
+	}, recorder.Middleware)
+
+	account := &Account{Id: "1", OrganisationId: uuid4s(rand.Uint64), Attributes: &AccountAttributes{Country: "GB"}}
+	if _, apiErr := client.UpdateAccount(context.Background(), "1", account); apiErr != nil {
+		t.Fatalf("UpdateAccount() failed: %s", apiErr)
+	}
+
+	var buf bytes.Buffer
+	if _, err := recorder.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo() failed: %s", err)
+	}
+	if strings.Contains(buf.String(), "secret") {
+		t.Error("The Authorization header was not redacted")
+	}
+	var har harFile
+	if err := json.Unmarshal(buf.Bytes(), &har); err != nil {
+		t.Fatalf("Invalid HAR: %s", err)
+	}
+	if har.Log.Version != "1.2" || len(har.Log.Entries) != 2 {
+		t.Fatalf("Expected HAR 1.2 with 2 entries, got %s with %d", har.Log.Version, len(har.Log.Entries))
+	}
+
+	for i, entry := range har.Log.Entries {
+		if entry.Request.Method != http.MethodPatch || entry.Request.PostData == nil ||
+			!strings.Contains(entry.Request.PostData.Text, account.OrganisationId) {
+			t.Errorf("Unexpected request of entry %d: %+v", i, entry.Request)
+		}
+		for _, header := range entry.Request.Headers {
+			if header.Name == "Authorization" && header.Value != "REDACTED" {
+				t.Errorf("Authorization header of entry %d was not redacted", i)
+			}
+		}
+	}
+	if status := har.Log.Entries[0].Response.Status; status != http.StatusServiceUnavailable {
+		t.Errorf("Expected the 503 of the first attempt, got %d", status)
+	}
+	second := har.Log.Entries[1]
+	if second.Comment != "attempt 2" || second.Response.Status != http.StatusOK {
+		t.Errorf("Unexpected second entry: %s %d", second.Comment, second.Response.Status)
+	}
+	if second.Response.Content.Text != `{"data":{"id":"1","version":1}}` {
+		t.Errorf("Unexpected response content: %q", second.Response.Content.Text)
+	}
+}
+
+func TestHARRecorder_TransportError(t *testing.T) {
+	client, server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {})
+	server.Close()
+	client.SetRetries(1)
+	recorder := NewHARRecorder(HARSettings{MaxBodySize: -1})
+	client.Use(recorder.Middleware)
+
+	if _, apiErr := client.FetchAccount(context.Background(), "1"); apiErr == nil {
+		t.Fatal("FetchAccount() succeeded")
+	}
+	var buf bytes.Buffer
+	if _, err := recorder.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo() failed: %s", err)
+	}
+	var har harFile
+	if err := json.Unmarshal(buf.Bytes(), &har); err != nil {
+		t.Fatalf("Invalid HAR: %s", err)
+	}
+	if len(har.Log.Entries) != 1 || !strings.HasPrefix(har.Log.Entries[0].Comment, "attempt 1, error: ") {
+		t.Errorf("Expected the entry of the failed attempt, got %+v", har.Log.Entries)
+	}
+}
@@ -0,0 +1,255 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HedgeSettings configure a Hedger, zero values are replaced by defaults
+type HedgeSettings struct {
+	// Delay before sending the hedged request (default 100ms), until enough latencies are observed for Percentile
+	Delay time.Duration
+	// If set (like 0.95), the delay is this percentile of the observed latencies
+	Percentile float64
+	// Number of the most recent latencies considered for Percentile (default 100)
+	Window int
+	// Percentile is used once this many latencies are observed (default 20)
+	MinSamples int
+}
+
+// Hedger sends a second, hedged request when the response to an idempotent read (GET, like FetchAccount or the pages
+// of ListAccounts) takes longer than a delay: the first response received wins and the other request is cancelled.
+// This cuts the tail latency caused by a slow backend node, at the cost of extra requests.
+//
+// The delay is either fixed, or a percentile of the observed latencies (like the p95). A response with a transport
+// error doesn't win while the other request is pending. Safe for concurrent use, and may be shared by multiple clients.
+type Hedger struct {
+	settings HedgeSettings
+
+	mu sync.Mutex
+	// Ring buffer of the latest latencies
+	latencies []time.Duration
+	next      int
+	count     int
+}
+
+// NewHedger creates a Hedger
+func NewHedger(settings HedgeSettings) *Hedger {
+	if settings.Delay <= 0 {
+		settings.Delay = 100 * time.Millisecond
+	}
+	if settings.Window <= 0 {
+		settings.Window = 100
+	}
+	if settings.MinSamples <= 0 {
+		settings.MinSamples = 20
+	}
+	if settings.MinSamples > settings.Window {
+		settings.MinSamples = settings.Window
+	}
+	return &Hedger{settings: settings, latencies: make([]time.Duration, settings.Window)}
+}
+
+// Delay returns the current delay before the hedged request
+func (hedger *Hedger) Delay() time.Duration {
+	if hedger.settings.Percentile <= 0 {
+		return hedger.settings.Delay
+	}
+
+	hedger.mu.Lock()
+	if hedger.count < hedger.settings.MinSamples {
+		hedger.mu.Unlock()
+		return hedger.settings.Delay
+	}
+	latencies := append([]time.Duration(nil), hedger.latencies[:hedger.count]...)
+	hedger.mu.Unlock()
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	i := int(math.Ceil(hedger.settings.Percentile*float64(len(latencies)))) - 1
+	if i < 0 {
+		i = 0
+	} else if i >= len(latencies) {
+		i = len(latencies) - 1
+	}
+	return latencies[i]
+}
+
+// observe records the latency of a response
+func (hedger *Hedger) observe(latency time.Duration) {
+	hedger.mu.Lock()
+	hedger.latencies[hedger.next] = latency
+	hedger.next = (hedger.next + 1) % len(hedger.latencies)
+	if hedger.count < len(hedger.latencies) {
+		hedger.count++
+	}
+	hedger.mu.Unlock()
+}
+
+// hedgeResult is the outcome of one of the hedged requests
+type hedgeResult struct {
+	resp *http.Response
+	err  error
+	// Index of the request
+	i int
+	// The request was not sent, as it was not admitted (see roundTrip)
+	skipped bool
+}
+
+// roundTrip executes req through rt, hedged after the delay. Tells whether the hedged request was sent.
+//
+// The hedged request is sent once admitted by admit (with its context, cancelled when the first request wins), which
+// returns done to be invoked with its outcome. If it's not admitted, the first request decides.
+//
+// req shall have no body. The context of the winning request is cancelled when its response body gets closed.
+func (hedger *Hedger) roundTrip(rt http.RoundTripper, req *http.Request,
+	admit func(ctx context.Context) (func(*http.Response, error), error)) (*http.Response, bool, error) {
+	results := make(chan hedgeResult, 2)
+	var cancels []context.CancelFunc
+	launch := func(admit func(ctx context.Context) (func(*http.Response, error), error)) {
+		ctx, cancel := context.WithCancel(req.Context())
+		hedgeReq := req.Clone(ctx)
+		i := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			var done func(*http.Response, error)
+			if admit != nil {
+				var err error
+				if done, err = admit(ctx); err != nil {
+					results <- hedgeResult{err: err, i: i, skipped: true}
+					return
+				}
+			}
+			start := time.Now()
+			resp, err := rt.RoundTrip(hedgeReq)
+			if err == nil {
+				hedger.observe(time.Since(start))
+			}
+			if done != nil {
+				done(resp, err)
+			}
+			results <- hedgeResult{resp, err, i, false}
+		}()
+	}
+
+	// The first request is admitted by the caller
+	launch(nil)
+	timer := time.NewTimer(hedger.Delay())
+	defer timer.Stop()
+
+	pending := 1
+	hedged := false
+	var failed hedgeResult
+	for {
+		select {
+		case <-timer.C:
+			launch(admit)
+			pending++
+			hedged = true
+
+		case result := <-results:
+			pending--
+			if result.skipped {
+				hedged = false
+				if pending > 0 {
+					continue
+				}
+				// The first request failed meanwhile
+				result = failed
+			}
+			if result.err != nil && pending > 0 {
+				// Waits for the other request
+				cancels[result.i]()
+				failed = result
+				continue
+			}
+			if pending > 0 {
+				// The other request is cancelled, and its response discarded
+				cancels[1-result.i]()
+				go discardHedge(results)
+			}
+			if result.err != nil {
+				cancels[result.i]()
+				return nil, hedged, result.err
+			}
+			result.resp.Body = &cancelOnClose{ReadCloser: result.resp.Body, cancel: cancels[result.i]}
+			return result.resp, hedged, nil
+		}
+	}
+}
+
+// admitHedge lets a hedged request of Do pass the circuit breaker and the rate limiter of the client, like the
+// attempts do, waiting for the rate limiter until ctx is done. The request is counted in flight until done is invoked
+// with its outcome.
+//
+// The breaker slot of the hedged request is released rather than recorded: Do records the outcome of the attempt, the
+// winning response, while the losing request is cancelled by the Hedger, which is not an outcome of the API.
+func (config *clientConfig) admitHedge(ctx context.Context) (done func(*http.Response, error), err error) {
+	var breakerRelease func()
+	if config.circuitBreaker != nil {
+		var allowed bool
+		if _, breakerRelease, allowed = config.circuitBreaker.allow(); !allowed {
+			return nil, errCircuitOpen
+		}
+	}
+	if config.rateLimiter != nil {
+		if err := config.rateLimiter.Wait(ctx); err != nil {
+			if breakerRelease != nil {
+				breakerRelease()
+			}
+			return nil, err
+		}
+	}
+
+	config.metrics.InFlight(1)
+	return func(resp *http.Response, err error) {
+		config.metrics.InFlight(-1)
+		if breakerRelease != nil {
+			breakerRelease()
+		}
+		if config.rateLimiter != nil {
+			config.rateLimiter.Observe(resp)
+		}
+	}, nil
+}
+
+// discardHedge closes the response of the (cancelled) request losing the race
+func discardHedge(results <-chan hedgeResult) {
+	if loser := <-results; loser.resp != nil {
+		_ = loser.resp.Body.Close()
+	}
+}
+
+// cancelOnClose cancels the context of a request when its response body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Implements io.Closer interface
+func (body *cancelOnClose) Close() error {
+	err := body.ReadCloser.Close()
+	body.cancel()
+	return err
+}
+
+// Gets the Hedger of the client, or nil
+func (client *ApiClient) Hedger() *Hedger {
+	return client.snapshot().hedger
+}
+
+// Sets a Hedger for the idempotent reads of the client (GET requests without body, like FetchAccount and the pages of
+// ListAccounts), nil disables hedging.
+//
+// The hedged request has to pass the RateLimiter and the CircuitBreaker of the client, like an attempt, and is counted
+// by MetricsCollector.InFlight, but it's not observed as a request of its own (the attempt is, with the winning
+// response).
+func (client *ApiClient) SetHedger(hedger *Hedger) {
+	client.update(func(config *clientConfig) { config.hedger = hedger })
+}
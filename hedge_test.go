@@ -0,0 +1,185 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHedger_SlowRequestHedged(t *testing.T) {
+	var requests, cancelled int32
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			// The slow backend node
+			select {
+			case <-r.Context().Done():
+				atomic.AddInt32(&cancelled, 1)
+				return
+			case <-time.After(5 * time.Second):
+			}
+		}
+		w.Header().Set("Content-Type", ContentType)
+		_, _ = w.Write([]byte(`{"data":{"id":"1"}}`))
+	})
+	client.SetHedger(NewHedger(HedgeSettings{Delay: 20 * time.Millisecond}))
+
+	start := time.Now()
+	account, apiErr := client.FetchAccount(context.Background(), "1")
+	if apiErr != nil {
+		t.Fatalf("FetchAccount() failed: %s", apiErr)
+	}
+	if account.Id != "1" {
+		t.Errorf("Unexpected account: %v", account)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Hedged request did not win, took %v", elapsed)
+	}
+	if requests := atomic.LoadInt32(&requests); requests != 2 {
+		t.Errorf("Expected 2 requests, received %d", requests)
+	}
+
+	// The slow request gets cancelled
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt32(&cancelled) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if atomic.LoadInt32(&cancelled) != 1 {
+		t.Error("The slow request was not cancelled")
+	}
+}
+
+func TestHedger_FastRequestNotHedged(t *testing.T) {
+	var requests int32
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Content-Type", ContentType)
+		_, _ = w.Write([]byte(`{"data":{"id":"1"}}`))
+	})
+	hedger := NewHedger(HedgeSettings{Delay: time.Second})
+	client.SetHedger(hedger)
+
+	for i := 0; i < 3; i++ {
+		if _, apiErr := client.FetchAccount(context.Background(), "1"); apiErr != nil {
+			t.Fatalf("FetchAccount() failed: %s", apiErr)
+		}
+	}
+	if requests := atomic.LoadInt32(&requests); requests != 3 {
+		t.Errorf("Expected 3 requests, received %d", requests)
+	}
+}
+
+func TestHedger_PercentileDelay(t *testing.T) {
+	hedger := NewHedger(HedgeSettings{Delay: time.Second, Percentile: 0.95, MinSamples: 10})
+	for i := 1; i < 10; i++ {
+		hedger.observe(time.Duration(i) * time.Millisecond)
+	}
+	if delay := hedger.Delay(); delay != time.Second {
+		t.Errorf("Expected the fixed delay before MinSamples, got %v", delay)
+	}
+	for i := 10; i <= 100; i++ {
+		hedger.observe(time.Duration(i) * time.Millisecond)
+	}
+	if delay := hedger.Delay(); delay != 95*time.Millisecond {
+		t.Errorf("Expected the p95 delay of 95ms, got %v", delay)
+	}
+}
+
+// inFlightMetrics is a MetricsCollector tracking the requests in flight
+type inFlightMetrics struct {
+	noMetrics
+	mu       sync.Mutex
+	inFlight int
+	max      int
+}
+
+// Implements MetricsCollector interface
+func (metrics *inFlightMetrics) InFlight(delta int) {
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	metrics.inFlight += delta
+	if metrics.inFlight > metrics.max {
+		metrics.max = metrics.inFlight
+	}
+}
+
+// newSlowFirstTestServer serves account 1, the first request after a delay
+func newSlowFirstTestServer(t *testing.T, requests *int32, delay time.Duration) *ApiClient {
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(requests, 1) == 1 {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(delay):
+			}
+		}
+		w.Header().Set("Content-Type", ContentType)
+		_, _ = w.Write([]byte(`{"data":{"id":"1"}}`))
+	})
+	client.SetHedger(NewHedger(HedgeSettings{Delay: 10 * time.Millisecond}))
+	return client
+}
+
+func TestHedger_RateLimited(t *testing.T) {
+	var requests int32
+	client := newSlowFirstTestServer(t, &requests, 100*time.Millisecond)
+	// Only the first request gets a token, the hedged one waits until the first wins
+	limiter := &countingLimiter{free: 1}
+	client.SetRateLimiter(limiter)
+
+	if _, apiErr := client.FetchAccount(context.Background(), "1"); apiErr != nil {
+		t.Fatalf("FetchAccount() failed: %s", apiErr)
+	}
+	if requests := atomic.LoadInt32(&requests); requests != 1 {
+		t.Errorf("Expected 1 request, received %d", requests)
+	}
+	if waits := atomic.LoadInt32(&limiter.waits); waits != 2 {
+		t.Errorf("Expected the hedged request to wait for the rate limiter, waited %d times", waits)
+	}
+}
+
+func TestHedger_CountedInFlight(t *testing.T) {
+	var requests int32
+	client := newSlowFirstTestServer(t, &requests, 5*time.Second)
+	metrics := &inFlightMetrics{}
+	client.SetMetrics(metrics)
+
+	if _, apiErr := client.FetchAccount(context.Background(), "1"); apiErr != nil {
+		t.Fatalf("FetchAccount() failed: %s", apiErr)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		metrics.mu.Lock()
+		inFlight, max := metrics.inFlight, metrics.max
+		metrics.mu.Unlock()
+		if inFlight == 0 || time.Now().After(deadline) {
+			if inFlight != 0 || max != 2 {
+				t.Errorf("Expected 2 requests in flight at most and none at the end, got %d and %d", max, inFlight)
+			}
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestHedger_BreakerRecordsAttemptOnce(t *testing.T) {
+	var requests int32
+	client := newSlowFirstTestServer(t, &requests, 5*time.Second)
+	cb := NewCircuitBreaker(CircuitBreakerSettings{})
+	client.SetCircuitBreaker(cb)
+
+	if _, apiErr := client.FetchAccount(context.Background(), "1"); apiErr != nil {
+		t.Fatalf("FetchAccount() failed: %s", apiErr)
+	}
+	// The cancelled request losing the race is not a success of the API
+	time.Sleep(20 * time.Millisecond)
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.count != 1 {
+		t.Errorf("Expected 1 outcome recorded by the breaker, recorded %d", cb.count)
+	}
+}
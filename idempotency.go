@@ -0,0 +1,69 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// Header carrying the idempotency key of POST requests
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// Response header marking a response replayed by the server for a repeated idempotency key
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+// CreateMode selects how CreateAccount guards against duplicates when the POST request gets retried
+type CreateMode int
+
+const (
+	// Sends an Idempotency-Key header (generated, or from the context, see WithIdempotencyKey), kept across the
+	// retries of the request. The default mode.
+	CreateWithIdempotencyKey CreateMode = iota
+	// Checks for an existing account before the POST, and fetches the account if the POST results in a Conflict.
+	// Racy if the same id is used by multiple clients, for APIs without idempotency key support.
+	CreateProbeAndRefetch
+)
+
+// Gets the CreateMode of the client
+func (client *ApiClient) CreateMode() CreateMode {
+	return client.snapshot().createMode
+}
+
+// Sets the CreateMode of the client
+func (client *ApiClient) SetCreateMode(mode CreateMode) {
+	client.update(func(config *clientConfig) { config.createMode = mode })
+}
+
+// Context key type of the idempotency key
+type idempotencyKey struct{}
+
+// WithIdempotencyKey returns a copy of ctx carrying a caller-supplied idempotency key for CreateAccount.
+//
+// Reusing the key when repeating a CreateAccount call (after a timeout for example) lets the server recognise it.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+// IdempotencyKeyFromContext returns the idempotency key carried by ctx, if any
+func IdempotencyKeyFromContext(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(idempotencyKey{}).(string)
+	return key, ok && key != ""
+}
+
+// idempotencyKeyFor returns the caller-supplied idempotency key of ctx, or generates one
+func idempotencyKeyFor(ctx context.Context) (string, error) {
+	if key, ok := IdempotencyKeyFromContext(ctx); ok {
+		return key, nil
+	}
+	return newUUID4()
+}
+
+// replayedConflict tells whether a 409 Conflict response to a request with an idempotency key is the replay of an
+// earlier success under the same key, marked so by the server. Other conflicts are not assumed to be caused by an
+// earlier attempt, as that attempt may not have reached the server while another client created the same id.
+func replayedConflict(resp *http.Response) bool {
+	return resp != nil && resp.StatusCode == http.StatusConflict &&
+		strings.EqualFold(resp.Header.Get(IdempotentReplayedHeader), "true")
+}
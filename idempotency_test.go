@@ -0,0 +1,168 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func newIdempotencyTestAccount() *Account {
+	return &Account{
+		Id:             uuid4s(rand.Uint64),
+		OrganisationId: uuid4s(rand.Uint64),
+		Attributes:     &AccountAttributes{Country: "GB"},
+	}
+}
+
+func TestCreateAccount_IdempotencyKeyKeptAcrossRetries(t *testing.T) {
+	account := newIdempotencyTestAccount()
+
+	var mu sync.Mutex
+	var keys []string
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		keys = append(keys, r.Method+" "+r.Header.Get(IdempotencyKeyHeader))
+		posts := len(keys)
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", ContentType+"; charset=utf-8")
+		switch {
+		case r.Method == http.MethodPost && posts == 1:
+			w.WriteHeader(http.StatusBadGateway)
+		case r.Method == http.MethodPost:
+			w.Header().Set(IdempotentReplayedHeader, "true")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"data":{"id":"` + account.Id + `","version":0}}`))
+		default:
+			t.Errorf("Unexpected %s request", r.Method)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+	client.SetErrorBackOff(0)
+
+	created, apiErr := client.CreateAccount(context.Background(), account)
+	if apiErr != nil {
+		t.Fatalf("CreateAccount() failed: %s", apiErr)
+	}
+	if created == nil || created.Id != account.Id {
+		t.Fatalf("CreateAccount() returned %v", created)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(keys) != 2 {
+		t.Fatalf("Expected 2 POST requests, received %v", keys)
+	}
+	if keys[0] == "POST " || keys[0] != keys[1] {
+		t.Errorf("Expected the same Idempotency-Key for each retry, received %v", keys)
+	}
+}
+
+func TestCreateAccount_IdempotencyKeyFromContext(t *testing.T) {
+	account := newIdempotencyTestAccount()
+
+	var received string
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get(IdempotencyKeyHeader)
+		w.Header().Set("Content-Type", ContentType+"; charset=utf-8")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"data":{"id":"` + account.Id + `"}}`))
+	})
+
+	ctx := WithIdempotencyKey(context.Background(), "caller-key")
+	if _, apiErr := client.CreateAccount(ctx, account); apiErr != nil {
+		t.Fatalf("CreateAccount() failed: %s", apiErr)
+	}
+	if received != "caller-key" {
+		t.Errorf("Expected Idempotency-Key caller-key, received %q", received)
+	}
+}
+
+func TestCreateAccount_ConflictOfRetryFetches(t *testing.T) {
+	account := newIdempotencyTestAccount()
+
+	var mu sync.Mutex
+	var posts, gets int
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Content-Type", ContentType+"; charset=utf-8")
+		switch r.Method {
+		case http.MethodPost:
+			posts++
+			if posts == 1 {
+				// The account got created, but the response is lost
+				w.WriteHeader(http.StatusGatewayTimeout)
+			} else {
+				// The server recognises the key of the earlier attempt
+				w.Header().Set(IdempotentReplayedHeader, "true")
+				w.WriteHeader(http.StatusConflict)
+				_, _ = w.Write([]byte(`{"error_message":"Account cannot be created as it violates a duplicate constraint"}`))
+			}
+		case http.MethodGet:
+			gets++
+			_, _ = w.Write([]byte(`{"data":{"id":"` + account.Id + `","version":0}}`))
+		}
+	})
+	client.SetErrorBackOff(0)
+
+	created, apiErr := client.CreateAccount(context.Background(), account)
+	if apiErr != nil {
+		t.Fatalf("CreateAccount() failed: %s", apiErr)
+	}
+	if created == nil || created.Id != account.Id {
+		t.Fatalf("CreateAccount() returned %v", created)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if posts != 2 || gets != 1 {
+		t.Errorf("Expected 2 POST and 1 GET requests, received %d and %d", posts, gets)
+	}
+}
+
+func TestCreateAccount_UnmarkedConflictOfRetry(t *testing.T) {
+	var mu sync.Mutex
+	var posts int
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method != http.MethodPost {
+			t.Errorf("Unexpected %s request", r.Method)
+		}
+		w.Header().Set("Content-Type", ContentType+"; charset=utf-8")
+		posts++
+		if posts == 1 {
+			// The first attempt didn't create the account, another client did meanwhile
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusConflict)
+		_, _ = w.Write([]byte(`{"error_message":"duplicate"}`))
+	})
+	client.SetErrorBackOff(0)
+
+	created, apiErr := client.CreateAccount(context.Background(), newIdempotencyTestAccount())
+	if apiErr == nil || apiErr.StatusCode != http.StatusConflict || created != nil {
+		t.Errorf("Expected a Conflict error, received %v, %v", created, apiErr)
+	}
+}
+
+func TestCreateAccount_ConflictOfFirstAttempt(t *testing.T) {
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("Unexpected %s request", r.Method)
+		}
+		w.Header().Set("Content-Type", ContentType+"; charset=utf-8")
+		w.WriteHeader(http.StatusConflict)
+		_, _ = w.Write([]byte(`{"error_message":"duplicate"}`))
+	})
+
+	_, apiErr := client.CreateAccount(context.Background(), newIdempotencyTestAccount())
+	if apiErr == nil || apiErr.StatusCode != http.StatusConflict {
+		t.Errorf("Expected a Conflict error, received %v", apiErr)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// LogLevel is the severity of a log message
+type LogLevel int
+
+const (
+	// Details of every request and response
+	LogLevelDebug LogLevel = iota
+	// Noteworthy events, like retries
+	LogLevelInfo
+	// Failures that may be recovered from, like a failed attempt
+	LogLevelWarn
+	// Failures that can not be recovered from
+	LogLevelError
+)
+
+// Implements fmt.Stringer interface
+func (level LogLevel) String() string {
+	switch level {
+	case LogLevelDebug:
+		return "DEBUG"
+	case LogLevelInfo:
+		return "INFO"
+	case LogLevelWarn:
+		return "WARN"
+	case LogLevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("LEVEL(%d)", int(level))
+}
+
+// Logger receives the log messages of ApiClient.
+//
+// Messages come with alternating key/value fields, like "method", "GET", "url", "https://...", "status", 200,
+// "attempt", 1, "latency", time.Duration.
+type Logger interface {
+	Log(ctx context.Context, level LogLevel, msg string, keyvals ...interface{})
+}
+
+// NopLogger discards all messages, the default Logger of ApiClient
+type NopLogger struct{}
+
+// Implements Logger interface
+func (NopLogger) Log(context.Context, LogLevel, string, ...interface{}) {}
+
+// StdLogger adapts a log.Logger of the standard library, printing messages at or above MinLevel as
+//
+//	LEVEL message key=value key=value
+type StdLogger struct {
+	Logger   *log.Logger
+	MinLevel LogLevel
+}
+
+// NewStdLogger creates a StdLogger, the standard logger of the log package is used if logger is nil
+func NewStdLogger(logger *log.Logger, minLevel LogLevel) *StdLogger {
+	if logger == nil {
+		logger = log.New(log.Writer(), log.Prefix(), log.Flags())
+	}
+	return &StdLogger{Logger: logger, MinLevel: minLevel}
+}
+
+// Implements Logger interface
+func (logger *StdLogger) Log(_ context.Context, level LogLevel, msg string, keyvals ...interface{}) {
+	if level < logger.MinLevel {
+		return
+	}
+
+	var line strings.Builder
+	line.WriteString(level.String())
+	line.WriteString(" ")
+	line.WriteString(msg)
+	for i := 0; i < len(keyvals); i += 2 {
+		if i+1 < len(keyvals) {
+			fmt.Fprintf(&line, " %v=%v", keyvals[i], keyvals[i+1])
+		} else {
+			fmt.Fprintf(&line, " %v", keyvals[i])
+		}
+	}
+	logger.Logger.Print(line.String())
+}
+
+// Gets the Logger of the client
+func (client *ApiClient) Logger() Logger {
+	return client.snapshot().logger
+}
+
+// Sets the Logger of the client, nil silences it
+func (client *ApiClient) SetLogger(logger Logger) {
+	if logger == nil {
+		logger = NopLogger{}
+	}
+	client.update(func(config *clientConfig) { config.logger = logger })
+}
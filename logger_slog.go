@@ -0,0 +1,42 @@
+// Copyleft 2020
+
+//go:build go1.21
+// +build go1.21
+
+package interview_accountapi
+
+import (
+	"context"
+	"log/slog"
+)
+
+// SlogLogger adapts a structured slog.Logger of the standard library (Go 1.21+)
+type SlogLogger struct {
+	Logger *slog.Logger
+}
+
+// NewSlogLogger creates a SlogLogger, slog.Default() is used if logger is nil
+func NewSlogLogger(logger *slog.Logger) *SlogLogger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &SlogLogger{Logger: logger}
+}
+
+// Implements Logger interface
+func (logger *SlogLogger) Log(ctx context.Context, level LogLevel, msg string, keyvals ...interface{}) {
+	logger.Logger.Log(ctx, slogLevel(level), msg, keyvals...)
+}
+
+// slogLevel maps LogLevel to slog.Level
+func slogLevel(level LogLevel) slog.Level {
+	switch level {
+	case LogLevelDebug:
+		return slog.LevelDebug
+	case LogLevelInfo:
+		return slog.LevelInfo
+	case LogLevelWarn:
+		return slog.LevelWarn
+	}
+	return slog.LevelError
+}
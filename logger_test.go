@@ -0,0 +1,59 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingLogger collects log messages for tests
+type recordingLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (logger *recordingLogger) Log(_ context.Context, level LogLevel, msg string, keyvals ...interface{}) {
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	logger.messages = append(logger.messages, level.String()+" "+msg)
+}
+
+func TestStdLogger_Log(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStdLogger(log.New(&buf, "", 0), LogLevelInfo)
+
+	logger.Log(context.Background(), LogLevelDebug, "Hidden", "method", "GET")
+	logger.Log(context.Background(), LogLevelWarn, "Request failed", "method", "GET", "status", 502, "odd")
+
+	if got := buf.String(); got != "WARN Request failed method=GET status=502 odd\n" {
+		t.Errorf("Unexpected log output: %q", got)
+	}
+}
+
+func TestApiClient_SetLogger(t *testing.T) {
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	client.SetErrorBackOff(0)
+	logger := &recordingLogger{}
+	client.SetLogger(logger)
+
+	req, err := client.NewRequest(context.Background(), http.MethodGet, AccountsPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, apiErr := client.Do(context.Background(), req); apiErr == nil {
+		t.Fatal("Expected error for 503 response")
+	}
+
+	expected := "DEBUG Request,DEBUG Response,INFO Retrying request,DEBUG Request,DEBUG Response"
+	if got := strings.Join(logger.messages, ","); got != expected {
+		t.Errorf("Unexpected log messages: %s", got)
+	}
+}
@@ -0,0 +1,273 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prefix of the metric names rendered by Metrics
+const MetricsNamespace = "accountapi"
+
+// Default upper bounds (in seconds) of the latency histogram buckets of Metrics
+var DefaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// MetricsCollector receives the measurements of ApiClient.
+//
+// Paths are templates relative to the API root with resource ids replaced, like v1/organisation/accounts/{id}.
+type MetricsCollector interface {
+	// Invoked after each attempt in Do, status is 0 if there was no response
+	ObserveRequest(method, path string, status int, latency time.Duration)
+	// Invoked for each retry in Do
+	ObserveRetry(method, path string)
+	// Invoked for each page fetched by ListAccounts
+	ObservePage()
+	// Invoked with +1 before and -1 after each attempt in Do
+	InFlight(delta int)
+}
+
+// noMetrics discards all measurements, the default MetricsCollector of ApiClient
+type noMetrics struct{}
+
+func (noMetrics) ObserveRequest(string, string, int, time.Duration) {}
+func (noMetrics) ObserveRetry(string, string)                       {}
+func (noMetrics) ObservePage()                                      {}
+func (noMetrics) InFlight(int)                                      {}
+
+// Gets the MetricsCollector of the client, or nil
+func (client *ApiClient) Metrics() MetricsCollector {
+	metrics := client.snapshot().metrics
+	if _, nop := metrics.(noMetrics); nop {
+		return nil
+	}
+	return metrics
+}
+
+// Sets a MetricsCollector for the measurements of the client, nil disables it
+func (client *ApiClient) SetMetrics(metrics MetricsCollector) {
+	if metrics == nil {
+		metrics = noMetrics{}
+	}
+	client.update(func(config *clientConfig) { config.metrics = metrics })
+}
+
+// Label values of request metrics
+type requestLabels struct {
+	method string
+	path   string
+	status int
+}
+
+// Label values of metrics by method and path
+type routeLabels struct {
+	method string
+	path   string
+}
+
+// Latency histogram of a label set
+type histogram struct {
+	// Cumulative counts per bucket
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+// Metrics is an in-memory MetricsCollector, and an http.Handler rendering the measurements in the Prometheus text
+// exposition format (version 0.0.4). Safe for concurrent use, and may be shared by multiple clients.
+type Metrics struct {
+	mu       sync.Mutex
+	bounds   []float64
+	requests map[requestLabels]uint64
+	latency  map[routeLabels]*histogram
+	retries  map[routeLabels]uint64
+	pages    uint64
+	inFlight int64
+}
+
+// NewMetrics creates Metrics with latency histogram buckets of upper bounds in seconds,
+// DefaultLatencyBuckets if none given
+func NewMetrics(buckets ...float64) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	bounds := append([]float64(nil), buckets...)
+	sort.Float64s(bounds)
+
+	return &Metrics{
+		bounds:   bounds,
+		requests: make(map[requestLabels]uint64),
+		latency:  make(map[routeLabels]*histogram),
+		retries:  make(map[routeLabels]uint64),
+	}
+}
+
+// Implements MetricsCollector interface
+func (metrics *Metrics) ObserveRequest(method, path string, status int, latency time.Duration) {
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+
+	metrics.requests[requestLabels{method, path, status}]++
+
+	key := routeLabels{method, path}
+	h := metrics.latency[key]
+	if h == nil {
+		h = &histogram{buckets: make([]uint64, len(metrics.bounds))}
+		metrics.latency[key] = h
+	}
+	seconds := latency.Seconds()
+	for i, bound := range metrics.bounds {
+		if seconds <= bound {
+			h.buckets[i]++
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// Implements MetricsCollector interface
+func (metrics *Metrics) ObserveRetry(method, path string) {
+	metrics.mu.Lock()
+	metrics.retries[routeLabels{method, path}]++
+	metrics.mu.Unlock()
+}
+
+// Implements MetricsCollector interface
+func (metrics *Metrics) ObservePage() {
+	metrics.mu.Lock()
+	metrics.pages++
+	metrics.mu.Unlock()
+}
+
+// Implements MetricsCollector interface
+func (metrics *Metrics) InFlight(delta int) {
+	metrics.mu.Lock()
+	metrics.inFlight += int64(delta)
+	metrics.mu.Unlock()
+}
+
+// Implements http.Handler interface, renders the Prometheus text exposition format
+func (metrics *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = w.Write([]byte(metrics.String()))
+}
+
+// String renders the measurements in the Prometheus text exposition format, sorted by labels
+func (metrics *Metrics) String() string {
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+
+	var out strings.Builder
+
+	name := MetricsNamespace + "_requests_total"
+	writeMetricHeader(&out, name, "counter", "Number of HTTP request attempts by method, path and status code.")
+	requests := make([]requestLabels, 0, len(metrics.requests))
+	for labels := range metrics.requests {
+		requests = append(requests, labels)
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		a, b := requests[i], requests[j]
+		if a.path != b.path {
+			return a.path < b.path
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.status < b.status
+	})
+	for _, labels := range requests {
+		fmt.Fprintf(&out, "%s{method=%s,path=%s,status=\"%d\"} %d\n", name,
+			quoteLabel(labels.method), quoteLabel(labels.path), labels.status, metrics.requests[labels])
+	}
+
+	name = MetricsNamespace + "_request_duration_seconds"
+	writeMetricHeader(&out, name, "histogram", "Latency of HTTP request attempts by method and path.")
+	for _, labels := range sortedRoutes(metrics.latency) {
+		h := metrics.latency[labels]
+		prefix := fmt.Sprintf("method=%s,path=%s", quoteLabel(labels.method), quoteLabel(labels.path))
+		for i, bound := range metrics.bounds {
+			fmt.Fprintf(&out, "%s_bucket{%s,le=\"%s\"} %d\n", name, prefix, formatFloat(bound), h.buckets[i])
+		}
+		fmt.Fprintf(&out, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, prefix, h.count)
+		fmt.Fprintf(&out, "%s_sum{%s} %s\n", name, prefix, formatFloat(h.sum))
+		fmt.Fprintf(&out, "%s_count{%s} %d\n", name, prefix, h.count)
+	}
+
+	name = MetricsNamespace + "_retries_total"
+	writeMetricHeader(&out, name, "counter", "Number of HTTP request retries by method and path.")
+	for _, labels := range sortedRoutes(metrics.retries) {
+		fmt.Fprintf(&out, "%s{method=%s,path=%s} %d\n", name,
+			quoteLabel(labels.method), quoteLabel(labels.path), metrics.retries[labels])
+	}
+
+	name = MetricsNamespace + "_list_pages_total"
+	writeMetricHeader(&out, name, "counter", "Number of pages fetched by list actions.")
+	fmt.Fprintf(&out, "%s %d\n", name, metrics.pages)
+
+	name = MetricsNamespace + "_requests_in_flight"
+	writeMetricHeader(&out, name, "gauge", "Number of HTTP requests in flight.")
+	fmt.Fprintf(&out, "%s %d\n", name, metrics.inFlight)
+
+	return out.String()
+}
+
+// sortedRoutes returns the keys of a map keyed by routeLabels, sorted by path and method
+func sortedRoutes(m interface{}) []routeLabels {
+	var keys []routeLabels
+	switch m := m.(type) {
+	case map[routeLabels]uint64:
+		for key := range m {
+			keys = append(keys, key)
+		}
+	case map[routeLabels]*histogram:
+		for key := range m {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].path != keys[j].path {
+			return keys[i].path < keys[j].path
+		}
+		return keys[i].method < keys[j].method
+	})
+	return keys
+}
+
+// writeMetricHeader writes the HELP and TYPE lines of a metric
+func writeMetricHeader(out *strings.Builder, name, kind, help string) {
+	fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// quoteLabel quotes a label value escaping backslash, double-quote and line feed
+func quoteLabel(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	return `"` + value + `"`
+}
+
+// formatFloat formats a float the shortest way
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// Matches path segments which are resource ids: UUIDs and numbers
+var idSegment = regexp.MustCompile(`^([0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}|[0-9]+)$`)
+
+// pathTemplate returns the path of req relative to the API root, with resource ids replaced by {id}
+func (config *clientConfig) pathTemplate(req *http.Request) string {
+	pth := strings.TrimPrefix(req.URL.Path, config.baseURL.Path)
+	segments := strings.Split(strings.Trim(pth, "/"), "/")
+	for i, segment := range segments {
+		if idSegment.MatchString(segment) {
+			segments[i] = "{id}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,76 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMetrics_ServeHTTP(t *testing.T) {
+	var requests int32
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", ContentType+"; charset=utf-8")
+		_, _ = w.Write([]byte(`{"data":{"id":"ad27e265-9605-4b4b-a0e5-3003ea9cc4dc"}}`))
+	})
+	client.SetErrorBackOff(0)
+	metrics := NewMetrics(0.5, 1)
+	client.SetMetrics(metrics)
+
+	if _, apiErr := client.FetchAccount(context.Background(), "ad27e265-9605-4b4b-a0e5-3003ea9cc4dc"); apiErr != nil {
+		t.Fatal(apiErr)
+	}
+
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, _ := ioutil.ReadAll(recorder.Body)
+
+	for _, line := range []string{
+		"# TYPE accountapi_requests_total counter",
+		`accountapi_requests_total{method="GET",path="v1/organisation/accounts/{id}",status="200"} 1`,
+		`accountapi_requests_total{method="GET",path="v1/organisation/accounts/{id}",status="502"} 1`,
+		"# TYPE accountapi_request_duration_seconds histogram",
+		`accountapi_request_duration_seconds_bucket{method="GET",path="v1/organisation/accounts/{id}",le="+Inf"} 2`,
+		`accountapi_request_duration_seconds_count{method="GET",path="v1/organisation/accounts/{id}"} 2`,
+		`accountapi_retries_total{method="GET",path="v1/organisation/accounts/{id}"} 1`,
+		"accountapi_list_pages_total 0",
+		"accountapi_requests_in_flight 0",
+	} {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Errorf("Missing line from exposition: %s\n%s", line, body)
+		}
+	}
+}
+
+func TestApiClient_pathTemplate(t *testing.T) {
+	client, err := NewApiClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetBaseURL("http://localhost:8080/api/"); err != nil {
+		t.Fatal(err)
+	}
+
+	for pth, expected := range map[string]string{
+		AccountsPath: "v1/organisation/accounts",
+		AccountsPath + "/ad27e265-9605-4b4b-a0e5-3003ea9cc4dc?version=0": "v1/organisation/accounts/{id}",
+		"v1/organisation/accounts/123":                                   "v1/organisation/accounts/{id}",
+	} {
+		req, err := client.NewRequest(context.Background(), http.MethodGet, pth, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := client.snapshot().pathTemplate(req); got != expected {
+			t.Errorf("pathTemplate(%s) = %s, expected %s", pth, got, expected)
+		}
+	}
+}
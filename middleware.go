@@ -0,0 +1,105 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Middleware wraps the execution of each HTTP request attempt inside ApiClient.Do, like an http.RoundTripper wrapper.
+//
+// The next RoundTripper executes the request (through the rest of the chain). A Middleware may alter the request
+// before passing it on, inspect or replace the response, or short-circuit the request altogether.
+// The request body can be re-read through http.Request.GetBody, if Do can replay it (see Do).
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc adapts an ordinary function to http.RoundTripper
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+// Implements http.RoundTripper interface
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Hooks are callbacks around the request execution in ApiClient.Do, any of them may be nil
+type Hooks struct {
+	// Invoked before each attempt, returning an error aborts the attempt with that error
+	BeforeRequest func(req *http.Request) error
+	// Invoked after each attempt with either the response or the error
+	AfterResponse func(req *http.Request, resp *http.Response, err error)
+	// Invoked before retrying a failed attempt, with the number of the upcoming attempt and the delay before it
+	OnRetry func(req *http.Request, attempt uint, delay time.Duration)
+}
+
+// Use appends middlewares to the chain of the client. The first middleware is the outermost, seeing the request
+// first and the response last.
+func (client *ApiClient) Use(middlewares ...Middleware) {
+	client.update(func(config *clientConfig) {
+		config.middlewares = append(append([]Middleware(nil), config.middlewares...), middlewares...)
+	})
+}
+
+// AddHooks appends BeforeRequest and AfterResponse of hooks to the middleware chain, and registers OnRetry
+func (client *ApiClient) AddHooks(hooks Hooks) {
+	if hooks.BeforeRequest != nil || hooks.AfterResponse != nil {
+		client.Use(hooks.middleware)
+	}
+	if hooks.OnRetry != nil {
+		client.update(func(config *clientConfig) {
+			retryHooks := make([]func(*http.Request, uint, time.Duration), len(config.retryHooks), len(config.retryHooks)+1)
+			copy(retryHooks, config.retryHooks)
+			config.retryHooks = append(retryHooks, hooks.OnRetry)
+		})
+	}
+}
+
+// middleware wraps BeforeRequest and AfterResponse hooks as Middleware
+func (hooks Hooks) middleware(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if hooks.BeforeRequest != nil {
+			if err := hooks.BeforeRequest(req); err != nil {
+				return nil, err
+			}
+		}
+		resp, err := next.RoundTrip(req)
+		if hooks.AfterResponse != nil {
+			hooks.AfterResponse(req, resp, err)
+		}
+		return resp, err
+	})
+}
+
+// roundTripper builds the middleware chain around the underlying HTTP client.
+//
+// Bearer token authentication (if any) is the innermost, so a 401 gets replayed without passing the chain again,
+// only wrapping the gzip decoding of the responses.
+func (config *clientConfig) roundTripper() http.RoundTripper {
+	var rt http.RoundTripper = RoundTripperFunc(config.httpClient.Do)
+	if config.acceptGzip {
+		rt = gunzip(rt)
+	}
+	if config.tokenSource != nil {
+		rt = bearerAuth(config.tokenSource, rt)
+	}
+	for i := len(config.middlewares) - 1; i >= 0; i-- {
+		rt = config.middlewares[i](rt)
+	}
+	return rt
+}
+
+// Context key type of the attempt number
+type attemptKey struct{}
+
+// withAttempt returns a copy of ctx carrying the number of the attempt
+func withAttempt(ctx context.Context, attempt uint) context.Context {
+	return context.WithValue(ctx, attemptKey{}, attempt)
+}
+
+// AttemptFromContext returns the number of the attempt (starting from 1) from the context of a request passed to
+// a Middleware by ApiClient.Do, or 0 if not available.
+func AttemptFromContext(ctx context.Context) uint {
+	attempt, _ := ctx.Value(attemptKey{}).(uint)
+	return attempt
+}
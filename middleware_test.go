@@ -0,0 +1,85 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestApiClient_Use(t *testing.T) {
+	var requests int32
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("X-Chain"); got != "outer,inner" {
+			t.Errorf("Middlewares applied in wrong order: %q", got)
+		}
+		if body, _ := ioutil.ReadAll(r.Body); string(body) != "hello" {
+			t.Errorf("Request body was not passed on: %q", body)
+		}
+		if atomic.AddInt32(&requests, 1) < 2 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	client.SetErrorBackOff(0)
+
+	chain := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				value := name
+				if prev := req.Header.Get("X-Chain"); prev != "" {
+					value = prev + "," + name
+				}
+				req.Header.Set("X-Chain", value)
+				return next.RoundTrip(req)
+			})
+		}
+	}
+	client.Use(chain("outer"), chain("inner"))
+
+	var before, after, retries int
+	var attempts []uint
+	client.AddHooks(Hooks{
+		BeforeRequest: func(req *http.Request) error {
+			before++
+			attempts = append(attempts, AttemptFromContext(req.Context()))
+			// The body can be peeked without consuming it
+			if body, err := req.GetBody(); err != nil {
+				t.Error(err)
+			} else if data, _ := ioutil.ReadAll(body); string(data) != "hello" {
+				t.Errorf("GetBody() returned %q", data)
+			}
+			return nil
+		},
+		AfterResponse: func(req *http.Request, resp *http.Response, err error) {
+			after++
+		},
+		OnRetry: func(req *http.Request, attempt uint, delay time.Duration) {
+			retries++
+			if attempt != 2 {
+				t.Errorf("OnRetry() received attempt %d instead of 2", attempt)
+			}
+		},
+	})
+
+	req, err := client.NewRequest(context.Background(), http.MethodPost, AccountsPath, strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, apiErr := client.Do(context.Background(), req); apiErr != nil {
+		t.Fatal(apiErr)
+	}
+
+	if before != 2 || after != 2 || retries != 1 {
+		t.Errorf("Unexpected hook invocations: before %d after %d retry %d", before, after, retries)
+	}
+	if len(attempts) != 2 || attempts[0] != 1 || attempts[1] != 2 {
+		t.Errorf("Unexpected attempt numbers: %v", attempts)
+	}
+}
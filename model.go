@@ -135,4 +135,6 @@ type ApiError struct {
 	ErrorCode    string `json:"error_code"`
 	// Included to save HTTP status code of the response
 	StatusCode int `json:"-"`
+	// The original error (like the transport or JSON decoding error), or nil (see Unwrap)
+	Err error `json:"-"`
 }
@@ -0,0 +1,196 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// By default tokens are refreshed this long before they expire
+const DefaultTokenExpiryDelta = 30 * time.Second
+
+// Token is an OAuth2 access token
+type Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	// Lifetime in seconds as received from the token endpoint
+	ExpiresIn int64 `json:"expires_in"`
+	// Calculated from ExpiresIn at receipt, zero if the token does not expire
+	Expiry time.Time `json:"-"`
+}
+
+// authorization returns the value for the Authorization header
+func (token *Token) authorization() string {
+	tokenType := token.TokenType
+	if tokenType == "" || strings.EqualFold(tokenType, "bearer") {
+		tokenType = "Bearer"
+	}
+	return tokenType + " " + token.AccessToken
+}
+
+// TokenSource supplies access tokens for ApiClient
+type TokenSource interface {
+	// Token returns a valid token, cached if possible
+	Token(ctx context.Context) (*Token, error)
+	// Invalidate drops token from the cache (if still cached), so the next Token call gets a fresh one
+	Invalidate(token *Token)
+}
+
+// ClientCredentials is a TokenSource for the OAuth2 client credentials grant.
+//
+// Tokens are cached until ExpiryDelta before they expire. Safe for concurrent use, concurrent callers wait for a
+// single token request.
+type ClientCredentials struct {
+	// URL of the token endpoint
+	TokenURL string
+	ClientID string
+	// Client secret, sent with HTTP basic authentication
+	ClientSecret string
+	// Optional scopes to request
+	Scopes []string
+	// Refresh tokens this long before expiry, DefaultTokenExpiryDelta if zero
+	ExpiryDelta time.Duration
+	// HTTP client for the token endpoint, http.DefaultClient if nil
+	HTTPClient *http.Client
+
+	mu    sync.Mutex
+	token *Token
+}
+
+// NewClientCredentials creates a ClientCredentials TokenSource
+func NewClientCredentials(tokenURL, clientID, clientSecret string, scopes ...string) *ClientCredentials {
+	return &ClientCredentials{TokenURL: tokenURL, ClientID: clientID, ClientSecret: clientSecret, Scopes: scopes}
+}
+
+// Implements TokenSource interface
+func (source *ClientCredentials) Token(ctx context.Context) (*Token, error) {
+	source.mu.Lock()
+	defer source.mu.Unlock()
+
+	delta := source.ExpiryDelta
+	if delta == 0 {
+		delta = DefaultTokenExpiryDelta
+	}
+	if source.token != nil && (source.token.Expiry.IsZero() || time.Now().Add(delta).Before(source.token.Expiry)) {
+		return source.token, nil
+	}
+
+	token, err := source.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	source.token = token
+	return token, nil
+}
+
+// Implements TokenSource interface
+func (source *ClientCredentials) Invalidate(token *Token) {
+	source.mu.Lock()
+	if source.token == token {
+		source.token = nil
+	}
+	source.mu.Unlock()
+}
+
+// fetch requests a new token from the token endpoint
+func (source *ClientCredentials) fetch(ctx context.Context) (*Token, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(source.Scopes) > 0 {
+		form.Set("scope", strings.Join(source.Scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, source.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(source.ClientID), url.QueryEscape(source.ClientSecret))
+
+	httpClient := source.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	received := time.Now()
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %s", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %s", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("token request failed with status %s: %s", resp.Status, body)
+	}
+
+	var token Token
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("failed decoding token response: %s", err)
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New("token response without access_token")
+	}
+	if token.ExpiresIn > 0 {
+		token.Expiry = received.Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	return &token, nil
+}
+
+// Gets the TokenSource of the client, or nil
+func (client *ApiClient) TokenSource() TokenSource {
+	return client.snapshot().tokenSource
+}
+
+// Sets a TokenSource to authenticate requests with bearer tokens, nil disables it
+func (client *ApiClient) SetTokenSource(source TokenSource) {
+	client.update(func(config *clientConfig) { config.tokenSource = source })
+}
+
+// bearerAuth attaches the token of source to each request. If the response is 401 Unauthorized, invalidates the
+// token and replays the request once with a fresh token.
+func bearerAuth(source TokenSource, next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		token, err := source.Token(req.Context())
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", token.authorization())
+
+		resp, err := next.RoundTrip(req)
+		if err != nil || resp.StatusCode != http.StatusUnauthorized {
+			return resp, err
+		}
+
+		// Refresh the token once and replay the request, unless the body can not be replayed
+		if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+			return resp, nil
+		}
+		source.Invalidate(token)
+		if token, err = source.Token(req.Context()); err != nil {
+			// Keeps the original 401 response
+			return resp, nil
+		}
+
+		replay := req.Clone(req.Context())
+		if req.GetBody != nil {
+			if replay.Body, err = req.GetBody(); err != nil {
+				return resp, nil
+			}
+		}
+		replay.Header.Set("Authorization", token.authorization())
+		_ = resp.Body.Close()
+		return next.RoundTrip(replay)
+	})
+}
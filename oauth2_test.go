@@ -0,0 +1,85 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestClientCredentials_RefreshOn401(t *testing.T) {
+	var issued, accepted int32
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "client" || secret != "s3cret" || r.FormValue("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		n := atomic.AddInt32(&issued, 1)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": fmt.Sprintf("token-%d", n),
+			"token_type":   "bearer",
+			"expires_in":   3600,
+		})
+	}))
+	defer tokenServer.Close()
+
+	// The API accepts only the token with the number in accepted
+	atomic.StoreInt32(&accepted, 1)
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		expected := fmt.Sprintf("Bearer token-%d", atomic.LoadInt32(&accepted))
+		if r.Header.Get("Authorization") != expected {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if body, _ := ioutil.ReadAll(r.Body); string(body) != "payload" {
+			t.Errorf("Request body was not replayed: %q", body)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	client.SetTokenSource(NewClientCredentials(tokenServer.URL, "client", "s3cret"))
+
+	do := func() *ApiError {
+		req, err := client.NewRequest(context.Background(), http.MethodPost, AccountsPath, strings.NewReader("payload"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, apiErr := client.Do(context.Background(), req)
+		return apiErr
+	}
+
+	for i := 0; i < 2; i++ {
+		if apiErr := do(); apiErr != nil {
+			t.Fatalf("Request #%d failed: %s", i, apiErr)
+		}
+	}
+	if n := atomic.LoadInt32(&issued); n != 1 {
+		t.Errorf("Token should be cached, issued %d", n)
+	}
+
+	// Revokes the cached token, the next request gets 401 and shall be replayed with a fresh token
+	atomic.StoreInt32(&accepted, 2)
+	if apiErr := do(); apiErr != nil {
+		t.Fatalf("Request was not replayed with a fresh token: %s", apiErr)
+	}
+	if n := atomic.LoadInt32(&issued); n != 2 {
+		t.Errorf("Expected a single refresh, issued %d", n)
+	}
+
+	// Refreshes only once, then gives up with the 401
+	atomic.StoreInt32(&accepted, 99)
+	if apiErr := do(); apiErr == nil || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 after a single refresh, got %v", apiErr)
+	}
+	if n := atomic.LoadInt32(&issued); n != 3 {
+		t.Errorf("Expected a single refresh, issued %d", n)
+	}
+}
@@ -0,0 +1,238 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Option configures an ApiClient created by NewApiClient. Options validate their arguments, errors are returned by
+// NewApiClient.
+type Option func(options *clientOptions) error
+
+// clientOptions collects the Options of NewApiClient, the transport is built once all of them are applied
+type clientOptions struct {
+	baseURL string
+	// Set by WithBaseURLs, for failover
+	baseURLs  []string
+	timeout   time.Duration
+	userAgent string
+	// Set by WithTransport, exclusive with the options configuring the default transport
+	transport http.RoundTripper
+	// Options of the default transport
+	rootCAs      *x509.CertPool
+	certificates []tls.Certificate
+	proxy        *url.URL
+	pool         *ConnectionPool
+}
+
+// ConnectionPool sizes the connection pool of the default transport, zero values keep the defaults of
+// http.DefaultTransport
+type ConnectionPool struct {
+	// Maximum number of idle connections across all hosts
+	MaxIdleConns int
+	// Maximum number of idle connections to keep per host
+	MaxIdleConnsPerHost int
+	// Maximum number of connections per host, including active ones
+	MaxConnsPerHost int
+	// Idle connections are closed after this long
+	IdleConnTimeout time.Duration
+}
+
+// WithBaseURL sets the API root URL (ApiBase by default)
+func WithBaseURL(apiBase string) Option {
+	return func(options *clientOptions) error {
+		u, err := url.Parse(apiBase)
+		if err != nil {
+			return err
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("base URL %q shall be http or https", apiBase)
+		}
+		options.baseURL = apiBase
+		return nil
+	}
+}
+
+// WithBaseURLs sets the API root URLs to fail over between, in order of preference, with the default
+// EndpointSettings (see EndpointPool and SetEndpoints). The probes use the transport of the client.
+func WithBaseURLs(baseURLs ...string) Option {
+	return func(options *clientOptions) error {
+		if _, err := NewEndpointPool(baseURLs, EndpointSettings{}); err != nil {
+			return err
+		}
+		options.baseURLs = baseURLs
+		return nil
+	}
+}
+
+// WithTimeout sets the overall request timeout (DefaultTimeout by default), 0 for no timeout
+func WithTimeout(timeout time.Duration) Option {
+	return func(options *clientOptions) error {
+		if timeout < 0 {
+			return fmt.Errorf("negative timeout %v", timeout)
+		}
+		options.timeout = timeout
+		return nil
+	}
+}
+
+// WithUserAgent sets the User-Agent header of the requests
+func WithUserAgent(userAgent string) Option {
+	return func(options *clientOptions) error {
+		if userAgent == "" {
+			return errors.New("empty user agent")
+		}
+		options.userAgent = userAgent
+		return nil
+	}
+}
+
+// WithRootCAs sets the pool of certificate authorities trusted to verify the server, instead of the system pool
+func WithRootCAs(pool *x509.CertPool) Option {
+	return func(options *clientOptions) error {
+		if pool == nil {
+			return errors.New("nil CA pool")
+		}
+		options.rootCAs = pool
+		return nil
+	}
+}
+
+// WithRootCAFile sets the certificate authorities (PEM encoded) trusted to verify the server, instead of the system pool
+func WithRootCAFile(pemFile string) Option {
+	return func(options *clientOptions) error {
+		data, err := ioutil.ReadFile(pemFile)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificates found in %s", pemFile)
+		}
+		options.rootCAs = pool
+		return nil
+	}
+}
+
+// WithClientCertificate adds a certificate presented to the server for mutual TLS authentication
+func WithClientCertificate(cert tls.Certificate) Option {
+	return func(options *clientOptions) error {
+		if len(cert.Certificate) == 0 || cert.PrivateKey == nil {
+			return errors.New("client certificate without certificate chain or private key")
+		}
+		options.certificates = append(options.certificates, cert)
+		return nil
+	}
+}
+
+// WithClientCertificateFiles adds a certificate presented to the server for mutual TLS authentication, loaded from
+// a pair of PEM encoded files
+func WithClientCertificateFiles(certFile, keyFile string) Option {
+	return func(options *clientOptions) error {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return err
+		}
+		options.certificates = append(options.certificates, cert)
+		return nil
+	}
+}
+
+// WithProxy sends the requests through an HTTP(S) or SOCKS5 proxy, instead of the one from the environment
+// (HTTPS_PROXY and the like)
+func WithProxy(proxyURL string) Option {
+	return func(options *clientOptions) error {
+		u, err := url.Parse(proxyURL)
+		if err != nil {
+			return err
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+		}
+		if u.Host == "" {
+			return fmt.Errorf("proxy URL %q without host", proxyURL)
+		}
+		options.proxy = u
+		return nil
+	}
+}
+
+// WithConnectionPool sizes the connection pool of the default transport
+func WithConnectionPool(pool ConnectionPool) Option {
+	return func(options *clientOptions) error {
+		if pool.MaxIdleConns < 0 || pool.MaxIdleConnsPerHost < 0 || pool.MaxConnsPerHost < 0 ||
+			pool.IdleConnTimeout < 0 {
+			return fmt.Errorf("negative connection pool setting %+v", pool)
+		}
+		options.pool = &pool
+		return nil
+	}
+}
+
+// WithTransport sets the http.RoundTripper executing the requests, instead of the default transport.
+// Exclusive with the options configuring the default transport (TLS, proxy, connection pool).
+func WithTransport(transport http.RoundTripper) Option {
+	return func(options *clientOptions) error {
+		if transport == nil {
+			return errors.New("nil transport")
+		}
+		options.transport = transport
+		return nil
+	}
+}
+
+// buildTransport returns the transport of the http.Client, nil for http.DefaultTransport
+func (options *clientOptions) buildTransport() (http.RoundTripper, error) {
+	custom := options.rootCAs != nil || len(options.certificates) > 0 || options.proxy != nil || options.pool != nil
+	if options.transport != nil {
+		if custom {
+			return nil, errors.New("WithTransport can not be combined with TLS, proxy or connection pool options")
+		}
+		return options.transport, nil
+	}
+	if !custom {
+		return nil, nil
+	}
+
+	defaultTransport, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return nil, errors.New("http.DefaultTransport is not an *http.Transport")
+	}
+	transport := defaultTransport.Clone()
+
+	if options.rootCAs != nil || len(options.certificates) > 0 {
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{}
+		}
+		transport.TLSClientConfig.RootCAs = options.rootCAs
+		transport.TLSClientConfig.Certificates = options.certificates
+	}
+	if options.proxy != nil {
+		transport.Proxy = http.ProxyURL(options.proxy)
+	}
+	if pool := options.pool; pool != nil {
+		if pool.MaxIdleConns > 0 {
+			transport.MaxIdleConns = pool.MaxIdleConns
+		}
+		if pool.MaxIdleConnsPerHost > 0 {
+			transport.MaxIdleConnsPerHost = pool.MaxIdleConnsPerHost
+		}
+		if pool.MaxConnsPerHost > 0 {
+			transport.MaxConnsPerHost = pool.MaxConnsPerHost
+		}
+		if pool.IdleConnTimeout > 0 {
+			transport.IdleConnTimeout = pool.IdleConnTimeout
+		}
+	}
+	return transport, nil
+}
@@ -0,0 +1,150 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewApiClient_InvalidOptions(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"base URL":        {WithBaseURL("ftp://example.com/")},
+		"base URLs":       {WithBaseURLs()},
+		"timeout":         {WithTimeout(-time.Second)},
+		"user agent":      {WithUserAgent("")},
+		"CA pool":         {WithRootCAs(nil)},
+		"CA file":         {WithRootCAFile("testdata/missing.pem")},
+		"client cert":     {WithClientCertificate(tls.Certificate{})},
+		"proxy scheme":    {WithProxy("ftp://proxy:21")},
+		"proxy host":      {WithProxy("http://")},
+		"pool":            {WithConnectionPool(ConnectionPool{MaxIdleConns: -1})},
+		"transport":       {WithTransport(nil)},
+		"transport+proxy": {WithTransport(http.DefaultTransport), WithProxy("http://proxy:3128")},
+	} {
+		if client, err := NewApiClient(opts...); err == nil || client != nil {
+			t.Errorf("NewApiClient() accepted invalid %s option", name)
+		}
+	}
+}
+
+func TestNewApiClient_TransportAndUserAgent(t *testing.T) {
+	var userAgent string
+	client, err := NewApiClient(
+		WithBaseURL("https://api.example.com/"),
+		WithUserAgent("accountapi-test/1.0"),
+		WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			userAgent = req.Header.Get("User-Agent")
+			return &http.Response{StatusCode: http.StatusNoContent, Header: http.Header{}, Body: http.NoBody}, nil
+		})),
+	)
+	if err != nil {
+		t.Fatalf("NewApiClient() failed: %s", err)
+	}
+
+	if apiErr := client.DeleteAccount(context.Background(), "1", 0); apiErr != nil {
+		t.Fatalf("DeleteAccount() failed: %s", apiErr)
+	}
+	if userAgent != "accountapi-test/1.0" {
+		t.Errorf("Unexpected User-Agent %q", userAgent)
+	}
+}
+
+func TestNewApiClient_Proxy(t *testing.T) {
+	var requested string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.String()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer proxy.Close()
+
+	client, err := NewApiClient(WithBaseURL("http://api.example.invalid/"), WithProxy(proxy.URL))
+	if err != nil {
+		t.Fatalf("NewApiClient() failed: %s", err)
+	}
+	if apiErr := client.DeleteAccount(context.Background(), "1", 0); apiErr != nil {
+		t.Fatalf("DeleteAccount() failed: %s", apiErr)
+	}
+	if requested != "http://api.example.invalid/"+AccountsPath+"/1?version=0" {
+		t.Errorf("Request was not sent through the proxy, proxy received %q", requested)
+	}
+}
+
+// newClientCertificate generates a self-signed certificate for TLS client authentication
+func newClientCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "accountapi-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestNewApiClient_MutualTLS(t *testing.T) {
+	clientCert := newClientCertificate(t)
+	leaf, err := x509.ParseCertificate(clientCert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(leaf)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 || r.TLS.PeerCertificates[0].Subject.CommonName != "accountapi-test" {
+			t.Error("Client certificate was not presented")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(server.Certificate())
+
+	client, err := NewApiClient(
+		WithBaseURL(server.URL+"/"),
+		WithRootCAs(rootCAs),
+		WithClientCertificate(clientCert),
+		WithConnectionPool(ConnectionPool{MaxIdleConnsPerHost: 4, IdleConnTimeout: time.Minute}),
+	)
+	if err != nil {
+		t.Fatalf("NewApiClient() failed: %s", err)
+	}
+	if apiErr := client.DeleteAccount(context.Background(), "1", 0); apiErr != nil {
+		t.Fatalf("DeleteAccount() failed: %s", apiErr)
+	}
+
+	// Without the CA pool the server is not trusted
+	client, err = NewApiClient(WithBaseURL(server.URL+"/"), WithClientCertificate(clientCert))
+	if err != nil {
+		t.Fatalf("NewApiClient() failed: %s", err)
+	}
+	client.SetRetries(1)
+	if apiErr := client.DeleteAccount(context.Background(), "1", 0); apiErr == nil {
+		t.Error("DeleteAccount() succeeded with an untrusted server certificate")
+	}
+}
@@ -0,0 +1,167 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Delay imposed on all requests of a TokenBucket after a 429 response without any hint on how long to wait
+const DefaultRateLimitPenalty = time.Second
+
+// RateLimiter throttles all requests of an ApiClient passing through Do (including the pages of ListAccounts)
+//
+// A RateLimiter may be shared by multiple ApiClients to throttle them together.
+type RateLimiter interface {
+	// Wait blocks until the next request is allowed, or returns ctx.Err() if ctx is done before
+	Wait(ctx context.Context) error
+	// Observe inspects every response for rate limiting signals from the server
+	Observe(resp *http.Response)
+}
+
+// TokenBucket is a RateLimiter allowing rate requests per second on average, with bursts of up to burst requests.
+//
+// It also slows down for a 429 Too Many Requests response (honoring Retry-After), and for the X-RateLimit-Remaining
+// and X-RateLimit-Reset headers: it won't burst above the remaining quota, and pauses until reset if it's exhausted.
+type TokenBucket struct {
+	mu sync.Mutex
+	// Tokens per second
+	rate float64
+	// Capacity of the bucket
+	burst float64
+	// Available tokens, negative if reserved by waiting requests
+	tokens float64
+	// Time of the last refill
+	last time.Time
+	// No tokens are handed out before this time
+	pausedUntil time.Time
+}
+
+// NewTokenBucket creates a TokenBucket with rate requests per second and burst capacity (min 1), initially full.
+//
+// A rate <= 0 means no limit of its own, only the signals of the server are followed.
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &TokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// refill adds the tokens accumulated since the last refill, must hold tb.mu
+func (tb *TokenBucket) refill(now time.Time) {
+	if now.After(tb.last) {
+		tb.tokens += now.Sub(tb.last).Seconds() * tb.rate
+		if tb.tokens > tb.burst {
+			tb.tokens = tb.burst
+		}
+		tb.last = now
+	}
+}
+
+// Implements RateLimiter interface
+//
+// Reserves a token right away and sleeps until it is due, so waiting requests are served in order.
+// The token is handed back if ctx is done before.
+func (tb *TokenBucket) Wait(ctx context.Context) error {
+	tb.mu.Lock()
+	now := time.Now()
+	tb.refill(now)
+	if tb.rate > 0 {
+		tb.tokens--
+	}
+
+	var delay time.Duration
+	if tb.tokens < 0 {
+		delay = time.Duration(-tb.tokens / tb.rate * float64(time.Second))
+	}
+	if pause := tb.pausedUntil.Sub(now); pause > delay {
+		delay = pause
+	}
+	tb.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	if err := sleepContext(ctx, delay); err != nil {
+		tb.mu.Lock()
+		if tb.rate > 0 {
+			tb.tokens++
+		}
+		tb.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Implements RateLimiter interface
+func (tb *TokenBucket) Observe(resp *http.Response) {
+	if resp == nil {
+		return
+	}
+	now := time.Now()
+
+	remaining, hasRemaining := parseRateLimitHeader(resp.Header.Get("X-RateLimit-Remaining"))
+	reset, hasReset := parseRateLimitReset(resp.Header.Get("X-RateLimit-Reset"), now)
+
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.refill(now)
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		wait, ok := parseRetryAfter(resp.Header.Get("Retry-After"), now)
+		if !ok && hasReset {
+			wait, ok = reset, true
+		}
+		if !ok {
+			wait = DefaultRateLimitPenalty
+		}
+		tb.pause(now.Add(wait))
+		return
+	}
+
+	if hasRemaining {
+		if remaining == 0 && hasReset {
+			tb.pause(now.Add(reset))
+		} else if float64(remaining) < tb.tokens {
+			tb.tokens = float64(remaining)
+		}
+	}
+}
+
+// pause stops handing out tokens until time t and drains the bucket, must hold tb.mu
+func (tb *TokenBucket) pause(t time.Time) {
+	if t.After(tb.pausedUntil) {
+		tb.pausedUntil = t
+	}
+	if tb.tokens > 0 {
+		tb.tokens = 0
+	}
+}
+
+// parseRateLimitHeader parses a non-negative integer header value
+func parseRateLimitHeader(value string) (uint64, bool) {
+	n, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+	return n, err == nil
+}
+
+// parseRateLimitReset parses X-RateLimit-Reset either as seconds until the reset, or as a unix timestamp if it's too
+// large for a delay, and returns the duration until the reset.
+func parseRateLimitReset(value string, now time.Time) (time.Duration, bool) {
+	n, ok := parseRateLimitHeader(value)
+	if !ok {
+		return 0, false
+	}
+	// Delays are unlikely to exceed a year, timestamps are well above
+	if n > 365*24*60*60 {
+		if wait := time.Unix(int64(n), 0).Sub(now); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+	return time.Duration(n) * time.Second, true
+}
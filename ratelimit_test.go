@@ -0,0 +1,94 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket_Wait(t *testing.T) {
+	tb := NewTokenBucket(20, 2)
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := tb.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Burst of 2 right away, then 2 more at 20/s
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond || elapsed > time.Second {
+		t.Errorf("Expected about 100ms for 4 tokens, took %v", elapsed)
+	}
+}
+
+func TestTokenBucket_WaitCancelled(t *testing.T) {
+	tb := NewTokenBucket(0.001, 1)
+	if err := tb.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := tb.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestTokenBucket_Observe(t *testing.T) {
+	tb := NewTokenBucket(1000, 10)
+
+	resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+	resp.Header.Set("Retry-After", "1")
+	tb.Observe(resp)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := tb.Wait(ctx); err == nil {
+		t.Error("Wait() should be paused after a 429 response")
+	}
+
+	tb = NewTokenBucket(1000, 10)
+	resp = &http.Response{StatusCode: http.StatusOK, Header: http.Header{}}
+	resp.Header.Set("X-RateLimit-Remaining", "0")
+	resp.Header.Set("X-RateLimit-Reset", "60")
+	tb.Observe(resp)
+
+	ctx2, cancel2 := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel2()
+	if err := tb.Wait(ctx2); err == nil {
+		t.Error("Wait() should be paused while the remaining quota is exhausted")
+	}
+}
+
+func TestDo_RateLimiter(t *testing.T) {
+	var requests int32
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	client.SetRateLimiter(NewTokenBucket(0.001, 1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	for i := 0; i < 2; i++ {
+		req, err := client.NewRequest(ctx, http.MethodDelete, AccountsPath, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, apiErr := client.Do(ctx, req)
+		if i == 0 && apiErr != nil {
+			t.Fatalf("First request should pass the limiter: %s", apiErr)
+		} else if i == 1 && apiErr == nil {
+			t.Fatal("Second request should be held back by the limiter")
+		}
+	}
+	if requests := atomic.LoadInt32(&requests); requests != 1 {
+		t.Errorf("Expected 1 request, received %d", requests)
+	}
+}
@@ -0,0 +1,171 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryAttempt describes a failed attempt of an HTTP request, passed to RetryPolicy
+type RetryAttempt struct {
+	// HTTP method of the request
+	Method string
+	// Status code of the response, 0 if there was no response
+	StatusCode int
+	// The response or nil, for inspecting headers like Retry-After (body shall not be consumed)
+	Response *http.Response
+	// Transport error of the attempt or nil
+	Err error
+	// Number of the attempt, starting from 1
+	Attempt uint
+	// Time elapsed since the initiation of the attempt
+	Elapsed time.Duration
+}
+
+// RetryPolicy decides whether a failed attempt of an HTTP request shall be retried, and how long to wait before.
+//
+// It is consulted by ApiClient.Do after each attempt that failed with either a transport error or a non-2xx status.
+// The returned delay is counted from the end of the failed attempt.
+type RetryPolicy interface {
+	Retry(attempt *RetryAttempt) (retry bool, delay time.Duration)
+}
+
+// retryableStatus tells whether a response status code could change by repeating the request.
+//
+// Status codes <200 400 401 403 404 405 406 407 409 410 414 418 431 are considered unrecoverable.
+func retryableStatus(statusCode int) bool {
+	if statusCode < 200 {
+		return false
+	}
+	switch statusCode {
+	case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound,
+		http.StatusMethodNotAllowed, http.StatusNotAcceptable, http.StatusProxyAuthRequired,
+		http.StatusConflict, http.StatusGone, http.StatusRequestURITooLong, http.StatusTeapot,
+		http.StatusRequestHeaderFieldsTooLarge:
+		return false
+	}
+	return true
+}
+
+// retryableFailure tells whether a failure is worth repeating: transport errors and recoverable status codes are,
+// but not the errors of producing the request body, validation, or the open circuit breaker. (see IsRetryable)
+func retryableFailure(statusCode int, err error) bool {
+	if err != nil {
+		var bodyErr *requestBodyError
+		return !errors.As(err, &bodyErr) && !errors.Is(err, ErrValidation) && err != errCircuitOpen
+	}
+	return retryableStatus(statusCode)
+}
+
+// retryable tells whether a failed attempt is worth repeating (see retryableFailure)
+func (attempt *RetryAttempt) retryable() bool {
+	return retryableFailure(attempt.StatusCode, attempt.Err)
+}
+
+// FixedBackOff retries up to Attempts (overall, min 1) with BackOff delay between the initiation of attempts.
+//
+// This is the default policy of ApiClient, built from ApiClient.Retries and ApiClient.ErrorBackOff.
+type FixedBackOff struct {
+	// Number of attempts overall
+	Attempts uint
+	// Delay between the initiation of successive attempts
+	BackOff time.Duration
+}
+
+// Implements RetryPolicy interface
+func (policy *FixedBackOff) Retry(attempt *RetryAttempt) (bool, time.Duration) {
+	if attempt.Attempt >= policy.Attempts || !attempt.retryable() {
+		return false, 0
+	}
+	return true, policy.BackOff - attempt.Elapsed
+}
+
+// ExponentialBackOff retries up to Attempts (overall, min 1) with exponentially growing delays and full jitter.
+//
+// The delay before attempt N+1 is a random duration in [0, min(Max, Base * 2^(N-1))), spreading out the retries of
+// concurrent clients instead of hitting the API in synchronised waves.
+type ExponentialBackOff struct {
+	// Number of attempts overall
+	Attempts uint
+	// Upper bound of the delay after the first attempt
+	Base time.Duration
+	// Upper bound of the delay at any attempt (0 means no limit)
+	Max time.Duration
+}
+
+// Implements RetryPolicy interface
+func (policy *ExponentialBackOff) Retry(attempt *RetryAttempt) (bool, time.Duration) {
+	if attempt.Attempt >= policy.Attempts || !attempt.retryable() {
+		return false, 0
+	}
+
+	ceiling := policy.Base
+	for i := uint(1); i < attempt.Attempt; i++ {
+		if policy.Max > 0 && ceiling >= policy.Max || ceiling > ceiling<<1 {
+			// Capped, or would overflow
+			break
+		}
+		ceiling <<= 1
+	}
+	if policy.Max > 0 && ceiling > policy.Max {
+		ceiling = policy.Max
+	}
+	if ceiling <= 0 {
+		return true, 0
+	}
+	return true, time.Duration(rand.Int63n(int64(ceiling)))
+}
+
+// RetryAfter honors the Retry-After header of 429 Too Many Requests and 503 Service Unavailable responses,
+// and falls back to Policy for anything else.
+//
+// Policy also decides whether to retry at all (limiting the number of attempts), only its delay gets overridden.
+// If the server asks to wait longer than MaxDelay (if non-zero), the request is not retried.
+type RetryAfter struct {
+	// The underlying policy
+	Policy RetryPolicy
+	// Longest acceptable Retry-After delay, 0 means no limit
+	MaxDelay time.Duration
+}
+
+// Implements RetryPolicy interface
+func (policy *RetryAfter) Retry(attempt *RetryAttempt) (bool, time.Duration) {
+	retry, delay := policy.Policy.Retry(attempt)
+	if !retry || attempt.Response == nil {
+		return retry, delay
+	}
+
+	switch attempt.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		if wait, ok := parseRetryAfter(attempt.Response.Header.Get("Retry-After"), time.Now()); ok {
+			if policy.MaxDelay > 0 && wait > policy.MaxDelay {
+				return false, 0
+			}
+			return true, wait
+		}
+	}
+	return retry, delay
+}
+
+// parseRetryAfter parses the value of a Retry-After header, either delay-seconds or an HTTP-date relative to now.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseUint(value, 10, 32); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := date.Sub(now); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
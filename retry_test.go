@@ -0,0 +1,98 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFixedBackOff_Retry(t *testing.T) {
+	policy := &FixedBackOff{Attempts: 2, BackOff: time.Second}
+
+	if retry, delay := policy.Retry(&RetryAttempt{StatusCode: 500, Attempt: 1, Elapsed: 300 * time.Millisecond}); !retry {
+		t.Error("500 should be retried on the first attempt")
+	} else if delay != 700*time.Millisecond {
+		t.Errorf("BackOff should be counted from the initiation of the attempt, got %v", delay)
+	}
+	if retry, _ := policy.Retry(&RetryAttempt{StatusCode: 500, Attempt: 2}); retry {
+		t.Error("Attempts should be exhausted after the second attempt")
+	}
+	if retry, _ := policy.Retry(&RetryAttempt{StatusCode: 404, Attempt: 1}); retry {
+		t.Error("404 should not be retried")
+	}
+	if retry, _ := policy.Retry(&RetryAttempt{Err: errors.New("connection reset"), Attempt: 1}); !retry {
+		t.Error("Transport errors should be retried")
+	}
+}
+
+func TestExponentialBackOff_Retry(t *testing.T) {
+	policy := &ExponentialBackOff{Attempts: 10, Base: 100 * time.Millisecond, Max: time.Second}
+
+	ceilings := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for i, ceiling := range ceilings {
+		attempt := &RetryAttempt{StatusCode: http.StatusServiceUnavailable, Attempt: uint(i + 1)}
+		for j := 0; j < 100; j++ {
+			retry, delay := policy.Retry(attempt)
+			if !retry {
+				t.Fatalf("Attempt %d should be retried", attempt.Attempt)
+			}
+			if delay < 0 || delay >= ceiling*time.Millisecond {
+				t.Fatalf("Delay %v of attempt %d is out of [0, %dms)", delay, attempt.Attempt, ceiling)
+			}
+		}
+	}
+
+	if retry, _ := policy.Retry(&RetryAttempt{StatusCode: 500, Attempt: 10}); retry {
+		t.Error("Attempts should be exhausted after the 10th attempt")
+	}
+}
+
+func TestRetryAfter_Retry(t *testing.T) {
+	policy := &RetryAfter{Policy: &FixedBackOff{Attempts: 3, BackOff: time.Second}, MaxDelay: time.Minute}
+
+	resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+	resp.Header.Set("Retry-After", "7")
+	attempt := &RetryAttempt{StatusCode: resp.StatusCode, Response: resp, Attempt: 1}
+	if retry, delay := policy.Retry(attempt); !retry || delay != 7*time.Second {
+		t.Errorf("Retry-After should be honored, got %t %v", retry, delay)
+	}
+
+	resp.Header.Set("Retry-After", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	if retry, _ := policy.Retry(attempt); retry {
+		t.Error("Retry-After above MaxDelay should not be retried")
+	}
+
+	resp.Header.Del("Retry-After")
+	if retry, delay := policy.Retry(attempt); !retry || delay != time.Second {
+		t.Errorf("Missing Retry-After should fall back to the underlying policy, got %t %v", retry, delay)
+	}
+}
+
+func TestDo_RetryPolicy(t *testing.T) {
+	var requests int32
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	client.SetRetryPolicy(&RetryAfter{Policy: &ExponentialBackOff{Attempts: 3, Base: time.Minute}})
+
+	req, err := client.NewRequest(context.Background(), http.MethodDelete, AccountsPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, apiErr := client.Do(context.Background(), req); apiErr != nil {
+		t.Fatalf("Do() failed after retries: %s", apiErr)
+	}
+	if requests := atomic.LoadInt32(&requests); requests != 3 {
+		t.Errorf("Expected 3 requests, received %d", requests)
+	}
+}
@@ -0,0 +1,279 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Signature algorithm for RSA keys (RSASSA-PKCS1-v1_5 with SHA-256)
+	SignatureAlgorithmRSA = "rsa-sha256"
+	// Signature algorithm for ECDSA keys (ASN.1 encoded, with SHA-256)
+	SignatureAlgorithmECDSA = "ecdsa-sha256"
+)
+
+// HTTPSigner signs requests in the style of the draft-cavage HTTP Signatures, as used by the Form3 API.
+//
+// The signed headers are (request-target), host and date, plus digest and content-length for requests with a body.
+// The Digest header carries the SHA-256 of the body. The signature is sent in the Authorization header:
+//
+//	Authorization: Signature keyId="...",algorithm="rsa-sha256",headers="(request-target) host date",signature="..."
+type HTTPSigner struct {
+	// Key ID registered with the API for the public key
+	KeyID string
+	// Private key, *rsa.PrivateKey or *ecdsa.PrivateKey
+	Key crypto.Signer
+	// Source of the Date header, time.Now if nil
+	Now func() time.Time
+}
+
+// NewHTTPSigner creates an HTTPSigner for an RSA or ECDSA private key
+func NewHTTPSigner(keyID string, key crypto.Signer) (*HTTPSigner, error) {
+	if keyID == "" {
+		return nil, errors.New("empty signature key id")
+	}
+	if _, err := signatureAlgorithm(key.Public()); err != nil {
+		return nil, err
+	}
+	return &HTTPSigner{KeyID: keyID, Key: key}, nil
+}
+
+// Middleware signs each attempt of the requests (including retries, with a fresh Date)
+func (signer *HTTPSigner) Middleware(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if err := signer.Sign(req); err != nil {
+			return nil, err
+		}
+		return next.RoundTrip(req)
+	})
+}
+
+// Sign sets the Date, Digest, Content-Length and Authorization headers of req.
+//
+// The body is read through req.GetBody, so it needs to be set for requests with a body (ApiClient.Do does).
+func (signer *HTTPSigner) Sign(req *http.Request) error {
+	algorithm, err := signatureAlgorithm(signer.Key.Public())
+	if err != nil {
+		return err
+	}
+
+	now := time.Now
+	if signer.Now != nil {
+		now = signer.Now
+	}
+	req.Header.Set("Date", now().UTC().Format(http.TimeFormat))
+
+	headers := []string{"(request-target)", "host", "date"}
+	if req.Body != nil && req.Body != http.NoBody {
+		digest, length, err := bodyDigest(req)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Digest", digest)
+		req.Header.Set("Content-Length", strconv.FormatInt(length, 10))
+		// The signed length is sent, even for a streamed body of unknown length
+		req.ContentLength = length
+		headers = append(headers, "digest", "content-length")
+	}
+
+	hash := sha256.Sum256([]byte(signingString(req, headers)))
+	signature, err := signer.Key.Sign(rand.Reader, hash[:], crypto.SHA256)
+	if err != nil {
+		return fmt.Errorf("signing request failed: %s", err)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf(`Signature keyId="%s",algorithm="%s",headers="%s",signature="%s"`,
+		signer.KeyID, algorithm, strings.Join(headers, " "), base64.StdEncoding.EncodeToString(signature)))
+	return nil
+}
+
+// HTTPSignatureVerifier verifies requests signed by HTTPSigner, mainly for testing offline
+type HTTPSignatureVerifier struct {
+	// Returns the public key (*rsa.PublicKey or *ecdsa.PublicKey) for a key ID
+	PublicKey func(keyID string) (crypto.PublicKey, error)
+	// Largest accepted difference between the Date header and now, 0 skips the check
+	MaxSkew time.Duration
+}
+
+// Verify checks the signature of req, the Digest of its body, and the Date header. Returns the key ID on success.
+//
+// The body is read through req.GetBody if set, otherwise it is read and replaced.
+func (verifier *HTTPSignatureVerifier) Verify(req *http.Request) (string, error) {
+	params, err := parseSignatureHeader(req.Header.Get("Authorization"))
+	if err != nil {
+		return "", err
+	}
+	keyID, headers := params["keyId"], strings.Fields(params["headers"])
+	if keyID == "" || len(headers) == 0 || params["signature"] == "" {
+		return "", errors.New("incomplete signature parameters")
+	}
+
+	for _, required := range []string{"(request-target)", "host", "date"} {
+		if !containsString(headers, required) {
+			return "", fmt.Errorf("signature does not cover %s", required)
+		}
+	}
+
+	if verifier.MaxSkew > 0 {
+		date, err := http.ParseTime(req.Header.Get("Date"))
+		if err != nil {
+			return "", fmt.Errorf("invalid Date header: %s", err)
+		}
+		if skew := time.Since(date); skew > verifier.MaxSkew || -skew > verifier.MaxSkew {
+			return "", fmt.Errorf("Date header is off by %v", skew)
+		}
+	}
+
+	if req.Body != nil && req.Body != http.NoBody {
+		if !containsString(headers, "digest") {
+			return "", errors.New("signature does not cover digest of the body")
+		}
+		if req.GetBody == nil {
+			body, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				return "", err
+			}
+			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+			req.GetBody = func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(bytes.NewReader(body)), nil
+			}
+		}
+		digest, _, err := bodyDigest(req)
+		if err != nil {
+			return "", err
+		}
+		if digest != req.Header.Get("Digest") {
+			return "", errors.New("digest mismatch")
+		}
+	}
+
+	key, err := verifier.PublicKey(keyID)
+	if err != nil {
+		return "", err
+	}
+	algorithm, err := signatureAlgorithm(key)
+	if err != nil {
+		return "", err
+	}
+	if params["algorithm"] != "" && params["algorithm"] != algorithm {
+		return "", fmt.Errorf("algorithm %s does not match the key", params["algorithm"])
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(params["signature"])
+	if err != nil {
+		return "", fmt.Errorf("invalid signature encoding: %s", err)
+	}
+	hash := sha256.Sum256([]byte(signingString(req, headers)))
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		err = rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature)
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, hash[:], signature) {
+			err = errors.New("ecdsa verification error")
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("invalid signature: %s", err)
+	}
+	return keyID, nil
+}
+
+// signatureAlgorithm returns the name of the signature algorithm for a public key
+func signatureAlgorithm(key crypto.PublicKey) (string, error) {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return SignatureAlgorithmRSA, nil
+	case *ecdsa.PublicKey:
+		return SignatureAlgorithmECDSA, nil
+	}
+	return "", fmt.Errorf("unsupported signature key type %T", key)
+}
+
+// signingString assembles the string to sign from the listed headers of req
+func signingString(req *http.Request, headers []string) string {
+	lines := make([]string, len(headers))
+	for i, header := range headers {
+		var value string
+		switch header {
+		case "(request-target)":
+			value = strings.ToLower(req.Method) + " " + req.URL.RequestURI()
+		case "host":
+			value = req.Host
+			if value == "" {
+				value = req.URL.Host
+			}
+		default:
+			value = strings.Join(req.Header.Values(header), ", ")
+		}
+		lines[i] = header + ": " + value
+	}
+	return strings.Join(lines, "\n")
+}
+
+// bodyDigest returns the value of the Digest header and the length of the body read through req.GetBody
+func bodyDigest(req *http.Request) (string, int64, error) {
+	if req.GetBody == nil {
+		return "", 0, errors.New("request body can not be re-read for digest")
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return "", 0, err
+	}
+	defer body.Close()
+
+	hash := sha256.New()
+	length, err := io.Copy(hash, body)
+	if err != nil {
+		return "", 0, err
+	}
+	return "SHA-256=" + base64.StdEncoding.EncodeToString(hash.Sum(nil)), length, nil
+}
+
+// parseSignatureHeader parses the parameters of an Authorization: Signature header
+func parseSignatureHeader(header string) (map[string]string, error) {
+	const prefix = "Signature "
+	if !strings.HasPrefix(header, prefix) {
+		return nil, errors.New("missing signature")
+	}
+
+	params := make(map[string]string)
+	for _, param := range strings.Split(header[len(prefix):], ",") {
+		eq := strings.Index(param, "=")
+		if eq < 0 {
+			return nil, fmt.Errorf("invalid signature parameter %q", param)
+		}
+		key := strings.TrimSpace(param[:eq])
+		value, err := strconv.Unquote(strings.TrimSpace(param[eq+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid signature parameter %q", param)
+		}
+		params[key] = value
+	}
+	return params, nil
+}
+
+// containsString tells whether list contains s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHTTPSigner_Verify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []crypto.Signer{rsaKey, ecKey} {
+		signer, err := NewHTTPSigner("key-1", key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		verifier := &HTTPSignatureVerifier{
+			PublicKey: func(keyID string) (crypto.PublicKey, error) {
+				if keyID != "key-1" {
+					return nil, errors.New("unknown key")
+				}
+				return key.Public(), nil
+			},
+			MaxSkew: time.Minute,
+		}
+
+		var verified int32
+		client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			if _, err := verifier.Verify(r); err != nil {
+				t.Errorf("Verify() failed for %T: %s", key, err)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			atomic.AddInt32(&verified, 1)
+			w.WriteHeader(http.StatusNoContent)
+		})
+		client.Use(signer.Middleware)
+
+		for _, body := range []string{"", `{"data":{}}`} {
+			req, err := client.NewRequest(context.Background(), http.MethodPost, AccountsPath, nil)
+			if body != "" {
+				req, err = client.NewRequest(context.Background(), http.MethodPost, AccountsPath,
+					strings.NewReader(body))
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, apiErr := client.Do(context.Background(), req); apiErr != nil {
+				t.Errorf("Signed request failed: %s", apiErr)
+			}
+		}
+		if verified := atomic.LoadInt32(&verified); verified != 2 {
+			t.Errorf("Expected 2 verified requests for %T, got %d", key, verified)
+		}
+	}
+}
+
+func TestHTTPSignatureVerifier_Tampered(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewHTTPSigner("key-1", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := &HTTPSignatureVerifier{PublicKey: func(string) (crypto.PublicKey, error) { return key.Public(), nil }}
+
+	newSignedRequest := func() *http.Request {
+		req, err := http.NewRequest(http.MethodPost, "https://api.example.com/v1/organisation/accounts",
+			strings.NewReader("original"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := signer.Sign(req); err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+
+	if _, err := verifier.Verify(newSignedRequest()); err != nil {
+		t.Fatalf("Untampered request should verify: %s", err)
+	}
+
+	req := newSignedRequest()
+	req.Header.Set("Date", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	if _, err := verifier.Verify(req); err == nil {
+		t.Error("Request with altered Date should not verify")
+	}
+
+	req = newSignedRequest()
+	req.Body, req.GetBody = ioutil.NopCloser(strings.NewReader("tampered")), nil
+	if _, err := verifier.Verify(req); err == nil {
+		t.Error("Request with altered body should not verify")
+	}
+
+	req = newSignedRequest()
+	req.URL.Path = "/v1/organisation/accounts/other"
+	if _, err := verifier.Verify(req); err == nil {
+		t.Error("Request with altered target should not verify")
+	}
+}
+
+// seekOnlyBody is a seekable request body which is not an io.ReaderAt
+type seekOnlyBody struct {
+	io.ReadSeeker
+}
+
+// Implements io.Closer interface
+func (seekOnlyBody) Close() error {
+	return nil
+}
+
+func TestHTTPSigner_SeekableBody(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewHTTPSigner("key-1", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := &HTTPSignatureVerifier{
+		PublicKey: func(string) (crypto.PublicKey, error) { return key.Public(), nil },
+		MaxSkew:   time.Minute,
+	}
+
+	var requests int32
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if _, err := verifier.Verify(r); err != nil {
+			t.Errorf("Verify() failed: %s", err)
+		} else if body, _ := ioutil.ReadAll(r.Body); string(body) != `{"data":{}}` {
+			t.Errorf("Unexpected body: %q", body)
+		}
+		// The first attempt fails, so the body is signed and sent again
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	client.SetErrorBackOff(0)
+	client.Use(signer.Middleware)
+
+	for _, body := range []io.ReadCloser{
+		&seekableBody{Reader: strings.NewReader(`{"data":{}}`)},
+		seekOnlyBody{strings.NewReader(`{"data":{}}`)},
+	} {
+		atomic.StoreInt32(&requests, 0)
+		req, err := client.NewRequest(context.Background(), http.MethodPost, AccountsPath, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.ContentLength = int64(len(`{"data":{}}`))
+		if _, apiErr := client.Do(context.Background(), req); apiErr != nil {
+			t.Errorf("Signed request of %T failed: %s", body, apiErr)
+		}
+		if requests := atomic.LoadInt32(&requests); requests != 2 {
+			t.Errorf("Expected 2 requests of %T, received %d", body, requests)
+		}
+	}
+}
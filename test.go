@@ -3,6 +3,7 @@
 package interview_accountapi
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -16,21 +17,33 @@ const ApiUrlEnvKey = "API_URL"
 
 type TestContext struct {
 	Client   *ApiClient
+	Ctx      context.Context
 	ApiBase  string
 	PageSize uint
 	T        *testing.T
+	// Source of the random test data, local to the test
+	Rand *rand.Rand
 }
 
 // NewTestContext returns a TestContext with initialised ApiClient and testing.T
 //
 // The purpose of TestContext is to collect repetitive test actions as utility methods.
 func NewTestContext(t *testing.T) *TestContext {
+	return newTestContext(t, os.Getenv(ApiUrlEnvKey), time.Now().UnixNano())
+}
+
+// newTestContext returns a TestContext for the API at apiBase, with the random test data generated from seed
+func newTestContext(t *testing.T, apiBase string, seed int64) *TestContext {
 	t.Log("NewTestContext()")
-	test := TestContext{PageSize: 1000, T: t}
+	test := TestContext{Ctx: context.Background(), PageSize: 1000, T: t, Rand: rand.New(rand.NewSource(seed))}
 
-	test.Client = NewApiClient()
+	client, err := NewApiClient()
+	if err != nil {
+		test.T.Fatalf("Failed to create ApiClient: %s", err)
+	}
+	test.Client = client
+	test.Client.SetLogger(NewStdLogger(nil, LogLevelDebug))
 
-	apiBase := os.Getenv(ApiUrlEnvKey)
 	if apiBase == "" {
 		test.T.Fatalf("Missing environment variable %s with API base URL", ApiUrlEnvKey)
 	}
@@ -39,31 +52,27 @@ func NewTestContext(t *testing.T) *TestContext {
 		test.T.Fatalf("Failed to set API base URL: %s", err)
 	}
 
-	rand.Seed(time.Now().UnixNano())
-	test.T.Log("Random seed initialised")
-
 	return &test
 }
 
-// alpha2 returns a random string of two capital latin letters.
-//
-// The random number generator shall be initialised beforehand by rand.Seed() to obtain a pseudo-random result.
-func alpha2() string {
+// alpha2 returns a random string of two capital latin letters, drawn from next (like rand.Uint64, or the method of a
+// local *rand.Rand).
+func alpha2(next func() uint64) string {
+	n := next()
 	return fmt.Sprintf("%c%c",
-		'A'+rand.Intn(26),
-		'A'+rand.Intn(26))
+		'A'+n%26,
+		'A'+n/26%26)
 }
 
-// uuid4s returns a random uuid4 string.
-//
-// The random number generator shall be initialised beforehand by rand.Seed() to obtain a pseudo-random result.
-func uuid4s() string {
+// uuid4s returns a random uuid4 string, drawn from next (like rand.Uint64, or the method of a local *rand.Rand).
+func uuid4s(next func() uint64) string {
+	high, low := next(), next()
 	return fmt.Sprintf("%08x-%04x-%04x-%04x-%012x",
-		rand.Uint32(),
-		rand.Int()&0xffff,
-		rand.Int()&0x0fff|0x4000,
-		rand.Int()&0x3fff|0x8000,
-		rand.Uint64()&0xffffffffffff,
+		high>>32,
+		high>>16&0xffff,
+		high&0x0fff|0x4000,
+		low>>48&0x3fff|0x8000,
+		low&0xffffffffffff,
 	)
 }
 
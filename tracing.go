@@ -0,0 +1,234 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceContext identifies a span of a distributed trace, as propagated by the W3C Trace Context headers
+// traceparent and tracestate.
+type TraceContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	// Trace flags, 0x01 is sampled
+	Flags byte
+	// Vendor specific trace state, forwarded as is
+	State string
+}
+
+// IsValid tells whether both TraceID and SpanID are non-zero
+func (tc TraceContext) IsValid() bool {
+	return tc.TraceID != [16]byte{} && tc.SpanID != [8]byte{}
+}
+
+// Traceparent formats the value of the traceparent header (version 00)
+func (tc TraceContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", hex.EncodeToString(tc.TraceID[:]), hex.EncodeToString(tc.SpanID[:]), tc.Flags)
+}
+
+// ParseTraceparent parses the value of a traceparent header, tracestate shall be set on the result separately
+func ParseTraceparent(value string) (TraceContext, error) {
+	var tc TraceContext
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 ||
+		parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return tc, fmt.Errorf("invalid traceparent %q", value)
+	}
+	var flags [1]byte
+	for _, field := range []struct {
+		dst []byte
+		src string
+	}{{tc.TraceID[:], parts[1]}, {tc.SpanID[:], parts[2]}, {flags[:], parts[3]}} {
+		if _, err := hex.Decode(field.dst, []byte(field.src)); err != nil {
+			return tc, fmt.Errorf("invalid traceparent %q", value)
+		}
+	}
+	tc.Flags = flags[0]
+	if !tc.IsValid() {
+		return tc, fmt.Errorf("invalid traceparent %q", value)
+	}
+	return tc, nil
+}
+
+// Context key type of TraceContext
+type traceContextKey struct{}
+
+// ContextWithTrace returns a copy of ctx carrying tc, to be propagated to the outgoing requests
+func ContextWithTrace(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, tc)
+}
+
+// TraceFromContext returns the TraceContext carried by ctx, if any
+func TraceFromContext(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(traceContextKey{}).(TraceContext)
+	return tc, ok && tc.IsValid()
+}
+
+// injectTrace sets the traceparent and tracestate headers of req from the TraceContext of ctx, if any
+func injectTrace(ctx context.Context, req *http.Request) {
+	tc, ok := TraceFromContext(ctx)
+	if !ok {
+		return
+	}
+	req.Header.Set("traceparent", tc.Traceparent())
+	if tc.State != "" {
+		req.Header.Set("tracestate", tc.State)
+	} else {
+		req.Header.Del("tracestate")
+	}
+}
+
+// Span is a traced unit of work
+type Span interface {
+	// Records an attribute of the span
+	SetAttribute(key string, value interface{})
+	// Finishes the span, with the error of the work or nil
+	End(err error)
+}
+
+// Tracer starts spans for the operations of ApiClient (like CreateAccount), with child spans for each HTTP attempt in
+// Do and each page fetched by ListAccounts.
+//
+// The returned context shall carry the TraceContext of the new span (see ContextWithTrace), which gets propagated to
+// the outgoing requests and the child spans.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// noTracer starts no spans, only the TraceContext of the caller's context gets propagated.
+// The default Tracer of ApiClient.
+type noTracer struct{}
+
+// noSpan does nothing
+type noSpan struct{}
+
+func (noTracer) Start(ctx context.Context, _ string) (context.Context, Span) { return ctx, noSpan{} }
+func (noSpan) SetAttribute(string, interface{})                              {}
+func (noSpan) End(error)                                                     {}
+
+// Gets the Tracer of the client, or nil
+func (client *ApiClient) Tracer() Tracer {
+	tracer := client.snapshot().tracer
+	if _, nop := tracer.(noTracer); nop {
+		return nil
+	}
+	return tracer
+}
+
+// Sets a Tracer for the operations of the client, nil disables it (the caller's TraceContext is still propagated)
+func (client *ApiClient) SetTracer(tracer Tracer) {
+	if tracer == nil {
+		tracer = noTracer{}
+	}
+	client.update(func(config *clientConfig) { config.tracer = tracer })
+}
+
+// endSpan finishes span with apiErr, avoiding a non-nil error interface of a nil *ApiError
+func endSpan(span Span, apiErr *ApiError) {
+	if apiErr != nil {
+		span.End(apiErr)
+	} else {
+		span.End(nil)
+	}
+}
+
+// RecordedSpan is a finished span of a SimpleTracer
+type RecordedSpan struct {
+	Name         string
+	TraceContext TraceContext
+	// SpanID of the parent span, zero for a root span
+	ParentSpanID [8]byte
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]interface{}
+	Err          error
+}
+
+// SimpleTracer is a Tracer generating W3C trace and span IDs, passing finished spans to OnEnd.
+//
+// It continues the trace of the caller's context (see ContextWithTrace), or starts a new sampled trace.
+// It's meant for logging spans or testing, bridging a full tracing library is a matter of implementing Tracer.
+type SimpleTracer struct {
+	// Receives every finished span
+	OnEnd func(span *RecordedSpan)
+}
+
+// Implements Tracer interface
+func (tracer *SimpleTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	span := &simpleSpan{tracer: tracer, RecordedSpan: RecordedSpan{
+		Name:       name,
+		Start:      time.Now(),
+		Attributes: make(map[string]interface{}),
+	}}
+
+	if parent, ok := TraceFromContext(ctx); ok {
+		span.TraceContext = parent
+		span.ParentSpanID = parent.SpanID
+	} else {
+		_, _ = rand.Read(span.TraceContext.TraceID[:])
+		span.TraceContext.Flags = 0x01
+	}
+	_, _ = rand.Read(span.TraceContext.SpanID[:])
+
+	return ContextWithTrace(ctx, span.TraceContext), span
+}
+
+// simpleSpan is a Span of SimpleTracer
+type simpleSpan struct {
+	RecordedSpan
+	tracer *SimpleTracer
+	mu     sync.Mutex
+	ended  bool
+}
+
+// Implements Span interface
+func (span *simpleSpan) SetAttribute(key string, value interface{}) {
+	span.mu.Lock()
+	span.Attributes[key] = value
+	span.mu.Unlock()
+}
+
+// Implements Span interface, only the first invocation has effect
+func (span *simpleSpan) End(err error) {
+	span.mu.Lock()
+	if span.ended {
+		span.mu.Unlock()
+		return
+	}
+	span.ended = true
+	span.RecordedSpan.End = time.Now()
+	span.Err = err
+	recorded := span.RecordedSpan
+	span.mu.Unlock()
+
+	if span.tracer.OnEnd != nil {
+		span.tracer.OnEnd(&recorded)
+	}
+}
+
+// Returned by TraceFromRequest when the traceparent header is missing
+var errNoTraceparent = errors.New("missing traceparent")
+
+// TraceFromRequest extracts the TraceContext of an incoming request from its traceparent and tracestate headers,
+// to be carried on with ContextWithTrace.
+func TraceFromRequest(req *http.Request) (TraceContext, error) {
+	value := req.Header.Get("traceparent")
+	if value == "" {
+		return TraceContext{}, errNoTraceparent
+	}
+	tc, err := ParseTraceparent(value)
+	if err != nil {
+		return tc, err
+	}
+	tc.State = req.Header.Get("tracestate")
+	return tc, nil
+}
@@ -0,0 +1,115 @@
+// Copyleft 2020
+
+package interview_accountapi
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	const value = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	tc, err := ParseTraceparent(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tc.Traceparent() != value {
+		t.Errorf("Traceparent() = %s, expected %s", tc.Traceparent(), value)
+	}
+
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01",
+	} {
+		if _, err := ParseTraceparent(invalid); err == nil {
+			t.Errorf("ParseTraceparent(%q) should fail", invalid)
+		}
+	}
+}
+
+func TestSimpleTracer_CreateAccount(t *testing.T) {
+	var mu sync.Mutex
+	var traceparents []string
+	client, _ := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		traceparents = append(traceparents, r.Header.Get("traceparent"))
+		mu.Unlock()
+		if r.Header.Get("tracestate") != "vendor=1" {
+			t.Errorf("tracestate was not propagated: %q", r.Header.Get("tracestate"))
+		}
+
+		if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", ContentType+"; charset=utf-8")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"data":{"id":"1"}}`))
+	})
+
+	// The fetch-post sequence of the probing mode gives nested spans
+	client.SetCreateMode(CreateProbeAndRefetch)
+
+	var spans []*RecordedSpan
+	client.SetTracer(&SimpleTracer{OnEnd: func(span *RecordedSpan) {
+		spans = append(spans, span)
+	}})
+
+	parent, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent.State = "vendor=1"
+	ctx := ContextWithTrace(context.Background(), parent)
+
+	account := &Account{Id: "1", OrganisationId: "2", Attributes: &AccountAttributes{Country: "GB"}}
+	if _, apiErr := client.CreateAccount(ctx, account); apiErr != nil {
+		t.Fatal(apiErr)
+	}
+
+	var names []string
+	spanIDs := make(map[[8]byte]*RecordedSpan)
+	for _, span := range spans {
+		names = append(names, span.Name)
+		spanIDs[span.TraceContext.SpanID] = span
+		if span.TraceContext.TraceID != parent.TraceID {
+			t.Errorf("Span %s is not in the trace of the caller", span.Name)
+		}
+	}
+	expected := []string{"HTTP GET", "FetchAccount", "HTTP POST", "CreateAccount"}
+	if len(names) != len(expected) {
+		t.Fatalf("Unexpected spans: %v", names)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Fatalf("Unexpected spans: %v", names)
+		}
+	}
+
+	if spans[3].ParentSpanID != parent.SpanID || spans[1].ParentSpanID != spans[3].TraceContext.SpanID ||
+		spans[0].ParentSpanID != spans[1].TraceContext.SpanID || spans[2].ParentSpanID != spans[3].TraceContext.SpanID {
+		t.Error("Spans are not nested as expected")
+	}
+	if spans[0].Err == nil || spans[1].Err == nil || spans[2].Err != nil || spans[3].Err != nil {
+		t.Error("Span errors are not recorded as expected")
+	}
+
+	// Each attempt carries the traceparent of its own span
+	mu.Lock()
+	defer mu.Unlock()
+	if len(traceparents) != 2 {
+		t.Fatalf("Expected 2 requests, received %d", len(traceparents))
+	}
+	for i, span := range []*RecordedSpan{spans[0], spans[2]} {
+		if traceparents[i] != span.TraceContext.Traceparent() {
+			t.Errorf("Request #%d carried traceparent %s instead of %s",
+				i, traceparents[i], span.TraceContext.Traceparent())
+		}
+	}
+}
@@ -2,7 +2,14 @@
 
 package interview_accountapi
 
-import "net/url"
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
 
 // parseURL parses URL string to url.URL struct and the query part to url.Values
 func parseURL(urlString string) (*url.URL, url.Values, error) {
@@ -24,3 +31,43 @@ func assembleURL(urlStruct *url.URL, queryValues url.Values) string {
 	}
 	return urlStruct.String()
 }
+
+// sleepContext waits for duration or until ctx is done, whichever comes first. Returns ctx.Err() if interrupted.
+func sleepContext(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// statusCode returns the status code of resp, or 0 if resp is nil
+func statusCode(resp *http.Response) int {
+	if resp == nil {
+		return 0
+	}
+	return resp.StatusCode
+}
+
+// successful tells whether resp is a success: 2xx, or 304 Not Modified to a conditional request
+func successful(req *http.Request, resp *http.Response) bool {
+	if resp.StatusCode == http.StatusNotModified {
+		return req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != ""
+	}
+	return 200 <= resp.StatusCode && resp.StatusCode < 300
+}
+
+// newUUID4 returns a random uuid4 string from a cryptographically secure source
+func newUUID4() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}